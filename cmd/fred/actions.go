@@ -0,0 +1,217 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/femnad/stuff/pkg/history"
+	"github.com/femnad/stuff/pkg/totp"
+)
+
+// MinOTPValidity is how long a code has to stay valid to be copied instead of the next one.
+const MinOTPValidity = 5 * time.Second
+
+// action is something fred can do with a picked entry. It returns a message describing what it
+// did, which is worth a notification if notify is set and the launcher is gone after the pick.
+type action struct {
+	name   string
+	run    func(opts options, selected selection) (string, error)
+	notify bool
+}
+
+// actions are offered in this order, the first one being what picking an entry does and the
+// others being bound to the custom keys of the menu.
+var actions = []action{
+	{name: "copy password", run: copyPassword},
+	{name: "copy username", run: copyUsername},
+	{name: "copy OTP", run: copyOTP, notify: true},
+	{name: "type password", run: typePassword},
+	{name: "autotype", run: autotype},
+}
+
+// Custom keys are numbered from 1 as in kb-custom-1 of rofi, with the ones up to the number of
+// actions running the actions after the first and the next one showing the fields of the entry.
+const (
+	pickKey        = 0
+	showFieldsName = "show fields"
+)
+
+var showFieldsKey = len(actions)
+
+func getKeyAction(key int) (action, error) {
+	if key < 0 || key >= len(actions) {
+		return action{}, fmt.Errorf("No action for custom key %d", key)
+	}
+	return actions[key], nil
+}
+
+// keyHelp describes the actions bound to custom keys, formatting each with the key number and
+// the action name.
+func keyHelp(format string) string {
+	help := make([]string, 0, len(actions))
+	for key := 1; key < len(actions); key++ {
+		help = append(help, fmt.Sprintf(format, key, actions[key].name))
+	}
+	help = append(help, fmt.Sprintf(format, showFieldsKey, showFieldsName))
+	return strings.Join(help, "  ")
+}
+
+func decryptSelection(opts options, selected selection) (string, error) {
+	return decrypt(opts.gpg, selected.store.gpgFile(selected.entry))
+}
+
+func copyPassword(opts options, selected selection) (string, error) {
+	content, err := decryptSelection(opts, selected)
+	if err != nil {
+		return "", err
+	}
+	err = copyWithTimeout(opts.clipboard, firstLine(content))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("Copied %s to clipboard. Will clear in %s.", selected.entry, opts.clipboard.Timeout), nil
+}
+
+func copyUsername(opts options, selected selection) (string, error) {
+	content, err := decryptSelection(opts, selected)
+	if err != nil {
+		return "", err
+	}
+	err = copyWithTimeout(opts.clipboard, parseEntry(content).username(selected.entry))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("Copied username of %s to clipboard.", selected.entry), nil
+}
+
+// currentOTP returns the code of key, waiting for the next one if the current code is about to
+// expire, along with how long the code stays valid.
+func currentOTP(key totp.Key) (string, time.Duration, error) {
+	now := time.Now()
+	remaining := key.Remaining(now)
+	if remaining < MinOTPValidity {
+		time.Sleep(remaining)
+		now = now.Add(remaining)
+		remaining = key.Period
+	}
+	code, err := key.Code(now)
+	return code, remaining, err
+}
+
+func entryOTP(name string, entry passEntry) (string, time.Duration, error) {
+	uri, ok := entry.field(OtpauthField)
+	if !ok {
+		return "", 0, fmt.Errorf("No otpauth line in %s", name)
+	}
+	key, err := totp.ParseURI(uri)
+	if err != nil {
+		return "", 0, fmt.Errorf("Error parsing otpauth line of %s: %w", name, err)
+	}
+	return currentOTP(key)
+}
+
+func copyOTP(opts options, selected selection) (string, error) {
+	entry, err := getEntryFields(opts, selected)
+	if err != nil {
+		return "", err
+	}
+	code, remaining, err := entryOTP(selected.entry, entry)
+	if err != nil {
+		return "", err
+	}
+	err = copyWithTimeout(opts.clipboard, code)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("Copied OTP of %s to clipboard. Valid for %s.", selected.entry, remaining.Round(time.Second)), nil
+}
+
+func typePassword(opts options, selected selection) (string, error) {
+	content, err := decryptSelection(opts, selected)
+	if err != nil {
+		return "", err
+	}
+	err = scheduleTyping(opts.typing, []typeStep{{Text: firstLine(content)}})
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("Typing password of %s.", selected.entry), nil
+}
+
+// autotype types the sequence of the entry, or the configured one, into the focused window.
+func autotype(opts options, selected selection) (string, error) {
+	entry, err := getEntryFields(opts, selected)
+	if err != nil {
+		return "", err
+	}
+	sequence := entrySequence(opts.typing, entry)
+	steps, err := parseSequence(sequence, selected.entry, entry)
+	if err != nil {
+		return "", err
+	}
+	err = scheduleTyping(opts.typing, steps)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("Typing %s of %s.", sequence, selected.entry), nil
+}
+
+// runAction records the pick of an entry and runs an action on it.
+func runAction(opts options, act action, selected string) (string, error) {
+	selection, err := parseSelection(opts.stores, selected)
+	if err != nil {
+		return "", err
+	}
+	recordSelection(selection)
+	return act.run(opts, selection)
+}
+
+// fieldNamespace is the history namespace of the fields of an entry, so each entry ranks its fields
+// by their own use.
+func fieldNamespace(selected selection) string {
+	return strings.Join([]string{"fields", selected.store.name, selected.entry}, storePrefixSeparator)
+}
+
+func getEntryFields(opts options, selected selection) (passEntry, error) {
+	content, err := decryptSelection(opts, selected)
+	if err != nil {
+		return passEntry{}, err
+	}
+	return parseEntry(content), nil
+}
+
+// getOrderedFields ranks the fields of an entry by their use, followed by the fields that were
+// never picked in the order they appear in the entry.
+func getOrderedFields(opts options, selected selection, entry passEntry) []string {
+	keys := entry.fieldKeys()
+	keyMap := buildPasswordMap(keys)
+
+	backend := getHistoryBackend()
+	defer backend.Close()
+	historyMap := filterRemovedHistoryItems(getHistoryMap(backend, fieldNamespace(selected)), keyMap)
+	orderedHistory := history.Rank(historyMap, getRanker(opts.ranking))
+	return append(orderedHistory, getPasswordNamesNotInHistory(keys, historyMap)...)
+}
+
+// copyField records the pick of a field of an entry and copies its value.
+func copyField(opts options, selected string, key string) (string, error) {
+	selection, err := parseSelection(opts.stores, selected)
+	if err != nil {
+		return "", err
+	}
+	entry, err := getEntryFields(opts, selection)
+	if err != nil {
+		return "", err
+	}
+	value, ok := entry.field(key)
+	if !ok {
+		return "", fmt.Errorf("No field %s in %s", key, selection.entry)
+	}
+	recordFieldSelection(selection, key)
+	err = copyWithTimeout(opts.clipboard, value)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("Copied %s of %s to clipboard.", key, selection.entry), nil
+}
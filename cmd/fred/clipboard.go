@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+const (
+	ClipboardTimeoutEnvVar  = "PASSWORD_STORE_CLIP_TIME"
+	DefaultClipboardTimeout = 45 * time.Second
+	RestoreClipboardFlag    = "restore-clipboard"
+)
+
+var (
+	x11Copy      = []string{"xclip", "-selection", "clipboard"}
+	x11Paste     = []string{"xclip", "-o", "-selection", "clipboard"}
+	waylandCopy  = []string{"wl-copy"}
+	waylandPaste = []string{"wl-paste", "-n"}
+)
+
+type clipboardConfig struct {
+	Copy    []string      `yaml:"copy"`
+	Paste   []string      `yaml:"paste"`
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// restoreRequest is what fred passes to the background process that restores the clipboard.
+type restoreRequest struct {
+	Clipboard clipboardConfig `json:"clipboard"`
+	Previous  string          `json:"previous"`
+	Checksum  []byte          `json:"checksum"`
+}
+
+func isWayland() bool {
+	return os.Getenv("WAYLAND_DISPLAY") != ""
+}
+
+// withDefaults fills in the clipboard commands for the running display server and the timeout
+// from the environment pass uses for it.
+func (c clipboardConfig) withDefaults() clipboardConfig {
+	if len(c.Copy) == 0 {
+		c.Copy = x11Copy
+		if isWayland() {
+			c.Copy = waylandCopy
+		}
+	}
+	if len(c.Paste) == 0 {
+		c.Paste = x11Paste
+		if isWayland() {
+			c.Paste = waylandPaste
+		}
+	}
+	clipTime := os.Getenv(ClipboardTimeoutEnvVar)
+	if clipTime != "" {
+		seconds, err := time.ParseDuration(clipTime + "s")
+		if err == nil {
+			c.Timeout = seconds
+		}
+	}
+	if c.Timeout == 0 {
+		c.Timeout = DefaultClipboardTimeout
+	}
+	return c
+}
+
+func copyToClipboard(cfg clipboardConfig, content string) error {
+	command := exec.Command(cfg.Copy[0], cfg.Copy[1:]...)
+	command.Stdin = strings.NewReader(content)
+	output, err := command.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("Error copying to clipboard: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+func pasteFromClipboard(cfg clipboardConfig) (string, error) {
+	output, err := exec.Command(cfg.Paste[0], cfg.Paste[1:]...).Output()
+	if err != nil {
+		return "", fmt.Errorf("Error reading clipboard: %w", err)
+	}
+	return string(output), nil
+}
+
+func checksum(content string) []byte {
+	sum := sha256.Sum256([]byte(content))
+	return sum[:]
+}
+
+// scheduleRestore starts a copy of fred in its own session that waits out the timeout and then
+// puts the previous clipboard content back, unless the clipboard has changed in the meantime.
+func scheduleRestore(cfg clipboardConfig, previous, copied string) error {
+	args := []string{fmt.Sprintf("-%s=%s", RestoreClipboardFlag, cfg.Timeout)}
+	return startDetached(args, restoreRequest{Clipboard: cfg, Previous: previous, Checksum: checksum(copied)})
+}
+
+func restoreClipboard(after time.Duration) error {
+	var request restoreRequest
+	err := readDetachedRequest(&request)
+	if err != nil {
+		return err
+	}
+	cfg := request.Clipboard
+	time.Sleep(after)
+	current, err := pasteFromClipboard(cfg)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(checksum(current), request.Checksum) {
+		return nil
+	}
+	return copyToClipboard(cfg, request.Previous)
+}
+
+// copyWithTimeout copies content to the clipboard and arranges for the previous clipboard content
+// to come back after the timeout.
+func copyWithTimeout(cfg clipboardConfig, content string) error {
+	previous, err := pasteFromClipboard(cfg)
+	if err != nil {
+		previous = ""
+	}
+	err = copyToClipboard(cfg, content)
+	if err != nil {
+		return err
+	}
+	return scheduleRestore(cfg, previous, content)
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/femnad/mare"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	ConfigFile          = "~/.config/fred/config.yaml"
+	ConfigFlag          = "config"
+	DefaultStoreName    = "pass"
+	PasswordStoreEnvVar = "PASSWORD_STORE_DIR"
+	storeFlagSeparator  = "="
+)
+
+type storeConfig struct {
+	Name string `yaml:"name"`
+	Path string `yaml:"path"`
+}
+
+type config struct {
+	Stores    []storeConfig   `yaml:"stores"`
+	Clipboard clipboardConfig `yaml:"clipboard"`
+	Typing    typingConfig    `yaml:"typing"`
+	Launcher  launcherConfig  `yaml:"launcher"`
+	Generate  generatorConfig `yaml:"generate"`
+	Git       gitConfig       `yaml:"git"`
+	Gpg       string          `yaml:"gpg"`
+	Ranking   string          `yaml:"ranking"`
+}
+
+type storeFlags []storeConfig
+
+func (s *storeFlags) String() string {
+	formatted := make([]string, 0, len(*s))
+	for _, store := range *s {
+		formatted = append(formatted, store.Name+storeFlagSeparator+store.Path)
+	}
+	return strings.Join(formatted, ",")
+}
+
+// Set accepts either a bare path or a name and a path separated by an equals sign.
+func (s *storeFlags) Set(value string) error {
+	store := storeConfig{Path: value}
+	separatorIndex := strings.Index(value, storeFlagSeparator)
+	if separatorIndex >= 0 {
+		store = storeConfig{Name: value[:separatorIndex], Path: value[separatorIndex+1:]}
+	}
+	*s = append(*s, store)
+	return nil
+}
+
+func readConfig(path string) (config, error) {
+	var cfg config
+	content, err := ioutil.ReadFile(mare.ExpandUser(path))
+	if os.IsNotExist(err) {
+		return cfg, nil
+	} else if err != nil {
+		return cfg, err
+	}
+	err = yaml.UnmarshalStrict(content, &cfg)
+	if err != nil {
+		return cfg, fmt.Errorf("Error parsing config %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// getStoreConfigs picks the stores from the command line, the environment, the config file or the
+// default location, whichever comes first.
+func getStoreConfigs(flagStores storeFlags, cfg config) []storeConfig {
+	if len(flagStores) > 0 {
+		return flagStores
+	}
+	storeDir := os.Getenv(PasswordStoreEnvVar)
+	if storeDir != "" {
+		return []storeConfig{{Path: storeDir}}
+	}
+	if len(cfg.Stores) > 0 {
+		return cfg.Stores
+	}
+	return []storeConfig{{Path: PasswordStore}}
+}
+
+type options struct {
+	stores           []*passwordStore
+	clipboard        clipboardConfig
+	typing           typingConfig
+	launcher         *launcher
+	generator        generatorConfig
+	generate         bool
+	git              gitConfig
+	watch            bool
+	gpg              string
+	ranking          string
+	restoreClipboard time.Duration
+	typeAfter        time.Duration
+	args             []string
+}
+
+func parseOptions() (options, error) {
+	var flagStores storeFlags
+	configFile := flag.String(ConfigFlag, ConfigFile, "config file")
+	flag.Var(&flagStores, "store", "password store as path or name=path, can be repeated")
+	restoreClipboard := flag.Duration(RestoreClipboardFlag, 0, "restore the clipboard content read from standard input after this long")
+	launcherName := flag.String("launcher", "", fmt.Sprintf("run a launcher to pick from: %s", strings.Join(launcherNames(), ", ")))
+	generate := flag.Bool("generate", false, "generate a password for a new entry, given or asked for")
+	watch := flag.Bool("watch", false, "keep the index of the stores fresh until interrupted")
+	typeAfter := flag.Duration(TypeFlag, 0, "type the text read from standard input after this long")
+	ranking := flag.String("ranking", "", "comma separated rankers from count, recency, frecency[:half-life] and alpha")
+	flag.Parse()
+
+	cfg, err := readConfig(*configFile)
+	if err != nil {
+		return options{}, err
+	}
+	stores, err := newPasswordStores(getStoreConfigs(flagStores, cfg))
+	if err != nil {
+		return options{}, err
+	}
+	var picker *launcher
+	if *launcherName != "" {
+		cfg.Launcher = launcherConfig{Name: *launcherName}
+	}
+	if cfg.Launcher.Name != "" || len(cfg.Launcher.Command) > 0 {
+		chosen, err := getLauncher(cfg.Launcher)
+		if err != nil {
+			return options{}, err
+		}
+		picker = &chosen
+	}
+	gpg := cfg.Gpg
+	if gpg == "" {
+		gpg = DefaultGpgCommand
+	}
+	return options{
+		stores:           stores,
+		clipboard:        cfg.Clipboard.withDefaults(),
+		typing:           cfg.Typing.withDefaults(),
+		launcher:         picker,
+		generator:        cfg.Generate.withDefaults(),
+		generate:         *generate,
+		git:              cfg.Git,
+		gpg:              gpg,
+		ranking:          getRanking(*ranking, cfg),
+		restoreClipboard: *restoreClipboard,
+		typeAfter:        *typeAfter,
+		watch:            *watch,
+		args:             flag.Args(),
+	}, nil
+}
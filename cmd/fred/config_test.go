@@ -0,0 +1,31 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestGetRanking(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "config.yaml")
+	err := ioutil.WriteFile(configFile, []byte("ranking: count,alpha\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := readConfig(configFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv(RankingEnvVar, "")
+	if ranking := getRanking("", cfg); ranking != "count,alpha" {
+		t.Errorf("Expected the ranking of the config file, got %s", ranking)
+	}
+	t.Setenv(RankingEnvVar, "recency")
+	if ranking := getRanking("", cfg); ranking != "recency" {
+		t.Errorf("Expected the ranking of the environment, got %s", ranking)
+	}
+	if ranking := getRanking("alpha", cfg); ranking != "alpha" {
+		t.Errorf("Expected the ranking of the command line, got %s", ranking)
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// startDetached runs fred again with args in a session of its own and hands it request on its
+// standard input, for work that has to outlive fred or the menu it runs under. The request carries
+// the configuration the work needs, the config file is passed on only so that reading it behaves
+// the same.
+func startDetached(args []string, request interface{}) error {
+	executable, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	configFlag := flag.Lookup(ConfigFlag)
+	if configFlag != nil {
+		args = append([]string{fmt.Sprintf("-%s=%s", ConfigFlag, configFlag.Value.String())}, args...)
+	}
+	content, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	command := exec.Command(executable, args...)
+	command.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	// Not waiting for the process means the request has to be written before returning, rather
+	// than copied in the background as exec does for other readers.
+	stdin, err := command.StdinPipe()
+	if err != nil {
+		return err
+	}
+	err = command.Start()
+	if err != nil {
+		return err
+	}
+	_, err = stdin.Write(content)
+	closeErr := stdin.Close()
+	if err != nil {
+		return err
+	}
+	if closeErr != nil {
+		return closeErr
+	}
+	return command.Process.Release()
+}
+
+func readDetachedRequest(request interface{}) error {
+	return json.NewDecoder(os.Stdin).Decode(request)
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"path"
+	"strings"
+)
+
+const (
+	PasswordField  = "password"
+	OtpauthField   = "otpauth"
+	otpauthPrefix  = "otpauth://"
+	fieldSeparator = ":"
+)
+
+var usernameFields = []string{"user", "username", "login"}
+
+type entryField struct {
+	key   string
+	value string
+}
+
+// passEntry is a decrypted entry in the usual layout of the password on the first line followed by
+// `key: value` lines and an `otpauth://` line. Lines in neither form are kept as notes.
+type passEntry struct {
+	password string
+	fields   []entryField
+	notes    []string
+}
+
+// parseField accepts `key: value` and `key:` but not `scheme://...`, so bare URLs end up as notes.
+func parseField(line string) (entryField, bool) {
+	separatorIndex := strings.Index(line, fieldSeparator)
+	if separatorIndex <= 0 {
+		return entryField{}, false
+	}
+	key, value := strings.TrimSpace(line[:separatorIndex]), line[separatorIndex+1:]
+	if key == "" || (value != "" && value[0] != ' ' && value[0] != '\t') {
+		return entryField{}, false
+	}
+	return entryField{key: key, value: strings.TrimSpace(value)}, true
+}
+
+func parseEntry(content string) passEntry {
+	lines := strings.Split(strings.TrimRight(content, "\n"), "\n")
+	entry := passEntry{password: lines[0]}
+	for _, line := range lines[1:] {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" {
+			continue
+		}
+		if strings.HasPrefix(trimmed, otpauthPrefix) {
+			entry.fields = append(entry.fields, entryField{key: OtpauthField, value: trimmed})
+			continue
+		}
+		field, ok := parseField(trimmed)
+		if ok {
+			entry.fields = append(entry.fields, field)
+		} else {
+			entry.notes = append(entry.notes, line)
+		}
+	}
+	return entry
+}
+
+// field looks up the first field with a key matching key regardless of case, the password
+// included.
+func (e passEntry) field(key string) (string, bool) {
+	if strings.EqualFold(key, PasswordField) {
+		return e.password, true
+	}
+	for _, field := range e.fields {
+		if strings.EqualFold(field.key, key) {
+			return field.value, true
+		}
+	}
+	return "", false
+}
+
+// fieldKeys lists the keys of the entry once each, the password first.
+func (e passEntry) fieldKeys() []string {
+	keys := []string{PasswordField}
+	seen := map[string]bool{PasswordField: true}
+	for _, field := range e.fields {
+		lowerKey := strings.ToLower(field.key)
+		if !seen[lowerKey] {
+			seen[lowerKey] = true
+			keys = append(keys, field.key)
+		}
+	}
+	return keys
+}
+
+// username falls back to the name of the entry as in the common website/username layout.
+func (e passEntry) username(name string) string {
+	for _, key := range usernameFields {
+		value, ok := e.field(key)
+		if ok {
+			return value
+		}
+	}
+	return path.Base(name)
+}
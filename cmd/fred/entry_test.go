@@ -0,0 +1,74 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseEntry(t *testing.T) {
+	entry := parseEntry("secret\nURL: https://example.com\nhttps://example.com/login\n\nrecovery:\n" +
+		"  otpauth://totp/Example:me?secret=JBSWY3DPEHPK3PXP\nsome note\n")
+	if entry.password != "secret" {
+		t.Errorf("Unexpected password %q", entry.password)
+	}
+	expectedFields := []entryField{
+		{key: "URL", value: "https://example.com"},
+		{key: "recovery", value: ""},
+		{key: OtpauthField, value: "otpauth://totp/Example:me?secret=JBSWY3DPEHPK3PXP"},
+	}
+	if !reflect.DeepEqual(entry.fields, expectedFields) {
+		t.Errorf("Expected fields %v, got %v", expectedFields, entry.fields)
+	}
+	if expectedNotes := []string{"https://example.com/login", "some note"}; !reflect.DeepEqual(entry.notes, expectedNotes) {
+		t.Errorf("Expected the bare URL as a note, got %v", entry.notes)
+	}
+}
+
+func TestParseField(t *testing.T) {
+	for line, expected := range map[string]entryField{
+		"user: me":         {key: "user", value: "me"},
+		"pin:\t1234":       {key: "pin", value: "1234"},
+		"empty:":           {key: "empty", value: ""},
+		"spaced key : x y": {key: "spaced key", value: "x y"},
+	} {
+		field, ok := parseField(line)
+		if !ok || field != expected {
+			t.Errorf("Expected %v for %q, got %v, %v", expected, line, field, ok)
+		}
+	}
+	for _, line := range []string{"https://example.com", ": value", "no separator", "key:value"} {
+		_, ok := parseField(line)
+		if ok {
+			t.Errorf("Expected %q not to be a field", line)
+		}
+	}
+}
+
+func TestFieldKeys(t *testing.T) {
+	entry := parseEntry("secret\nUser: me\nuser: other\nPassword: not the password\npin: 1234\n")
+	if keys := entry.fieldKeys(); !reflect.DeepEqual(keys, []string{PasswordField, "User", "pin"}) {
+		t.Errorf("Expected keys once each regardless of case, got %v", keys)
+	}
+	if value, _ := entry.field("USER"); value != "me" {
+		t.Errorf("Expected the first matching field, got %q", value)
+	}
+	if value, _ := entry.field(PasswordField); value != "secret" {
+		t.Errorf("Expected the password to come from the first line, got %q", value)
+	}
+	if _, ok := entry.field("email"); ok {
+		t.Error("Expected no email field")
+	}
+}
+
+func TestUsername(t *testing.T) {
+	for content, expected := range map[string]string{
+		"secret\nlogin: me\n":              "me",
+		"secret\nusername: me\nuser: us\n": "us",
+		"secret\nemail: me@example.com\n":  "alice",
+		"secret\n":                         "alice",
+	} {
+		if username := parseEntry(content).username("web/example.com/alice"); username != expected {
+			t.Errorf("Expected username %s for %q, got %s", expected, content, username)
+		}
+	}
+}
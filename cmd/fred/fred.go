@@ -1,11 +1,8 @@
 package main
 
 import (
-	"bufio"
 	"fmt"
-	"io/ioutil"
 	"os"
-	"path"
 	"strings"
 
 	"github.com/femnad/mare"
@@ -14,64 +11,13 @@ import (
 
 const (
 	GpgFileExtension = ".gpg"
-	HistoryFile      = "~/.config/fred/fred_history"
 	PasswordStore    = "~/.password-store"
 )
 
-func getDirsAndFiles(path string) ([]os.FileInfo, []os.FileInfo) {
-	dirs := make([]os.FileInfo, 0)
-	files := make([]os.FileInfo, 0)
-	dirContent, err := ioutil.ReadDir(path)
-
-	mare.PanicIfErr(err)
-
-	for _, fileInfo := range dirContent {
-		if fileInfo.IsDir() {
-			dirs = append(dirs, fileInfo)
-		} else {
-			files = append(files, fileInfo)
-		}
-	}
-	return dirs, files
-}
-
-func getAbsoluteNamesOfFiles(files []os.FileInfo, leadingPath string) []string {
-	fileNames := mare.MapFileInfo(files, os.FileInfo.Name)
-	prependPath := func(path string) string {
-		return fmt.Sprintf("%s/%s", leadingPath, path)
-	}
-	return mare.Map(fileNames, prependPath)
-}
-
-func getDirsAndFilesAsStrings(path string) ([]string, []string) {
-	dirs, files := getDirsAndFiles(path)
-	dirNames := getAbsoluteNamesOfFiles(dirs, path)
-	fileNames := getAbsoluteNamesOfFiles(files, path)
-	return dirNames, fileNames
-}
-
 func isGpgFile(path string) bool {
 	return strings.HasSuffix(path, GpgFileExtension)
 }
 
-func recursivelyListGpgFiles(path string) []string {
-	dirs, files := getDirsAndFilesAsStrings(path)
-	gpgFiles := mare.Filter(files, isGpgFile)
-	deeperFiles := mare.FlatMap(dirs, recursivelyListGpgFiles)
-	return append(gpgFiles, deeperFiles...)
-}
-
-func getRemoveStorePathPrefixFn(storePath string) func(string) string {
-	return func(path string) string {
-		return strings.TrimPrefix(path, storePath)
-	}
-}
-
-func removeLeadingSlashAndExtension(name string) string {
-	nameWithExtensionRemoved := strings.TrimSuffix(name, GpgFileExtension)
-	return strings.TrimLeft(nameWithExtensionRemoved, "/")
-}
-
 func buildPasswordMap(passwords []string) map[string]bool {
 	passwordMap := make(map[string]bool)
 	for _, password := range passwords {
@@ -80,11 +26,10 @@ func buildPasswordMap(passwords []string) map[string]bool {
 	return passwordMap
 }
 
-func getPasswordNames() []string {
-	passwordStore := mare.ExpandUser(PasswordStore)
-	files := recursivelyListGpgFiles(passwordStore)
-	filesWithoutStorePath := mare.Map(files, getRemoveStorePathPrefixFn(passwordStore))
-	return mare.Map(filesWithoutStorePath, removeLeadingSlashAndExtension)
+func getPasswordNames(passwordStore string) []string {
+	names, err := listEntries(passwordStore)
+	mare.PanicIfErr(err)
+	return names
 }
 
 func getNewItemFilterFn(historyMap history.History) func(string) bool {
@@ -109,65 +54,91 @@ func filterRemovedHistoryItems(historyMap history.History, passwordMap map[strin
 	return filteredHistoryItems
 }
 
-func getOrderedPasswords() []string {
-	passwordNames := getPasswordNames()
-	passwordMap := buildPasswordMap(passwordNames)
-	historyMap := getHistoryMap()
-	existingHistoryItems := filterRemovedHistoryItems(historyMap, passwordMap)
-	passwordsNotInHistory := getPasswordNamesNotInHistory(passwordNames, existingHistoryItems)
-	orderedHistory := history.GetOrderedHistoryByCount(existingHistoryItems)
+func prefixNames(stores []*passwordStore, store *passwordStore, names []string) []string {
+	return mare.Map(names, func(name string) string {
+		return displayName(stores, store, name)
+	})
+}
+
+// getOrderedPasswords ranks the entries of all stores together, each by its use in its own store,
+// followed by the entries that were never picked.
+func getOrderedPasswords(stores []*passwordStore, ranking string) []string {
+	backend := getHistoryBackend()
+	defer backend.Close()
+
+	combinedHistory := make(history.History)
+	passwordsNotInHistory := make([]string, 0)
+	for _, store := range stores {
+		passwordNames := getPasswordNames(store.path)
+		passwordMap := buildPasswordMap(passwordNames)
+		historyMap := getHistoryMap(backend, store.namespace)
+		existingHistoryItems := filterRemovedHistoryItems(historyMap, passwordMap)
+		for item, entry := range existingHistoryItems {
+			combinedHistory[displayName(stores, store, item)] = entry
+		}
+		notInHistory := getPasswordNamesNotInHistory(passwordNames, existingHistoryItems)
+		passwordsNotInHistory = append(passwordsNotInHistory, prefixNames(stores, store, notInHistory)...)
+	}
+	orderedHistory := history.Rank(combinedHistory, getRanker(ranking))
 	return append(orderedHistory, passwordsNotInHistory...)
 }
 
-func printPasswords() {
-	orderedPasswords := getOrderedPasswords()
+func printPasswords(opts options) {
+	orderedPasswords := getOrderedPasswords(opts.stores, opts.ranking)
 	for _, file := range orderedPasswords {
 		fmt.Println(file)
 	}
 }
 
-func getHistoryMap() history.History {
-	historyFile, err := mare.ExpandUserAndOpen(HistoryFile)
-	if os.IsNotExist(err) {
-		return make(history.History)
+// reportAndExit exits with 1 after a pick, the way rofi's script mode used to expect.
+func reportAndExit(message string, err error) {
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	} else {
+		fmt.Fprintln(os.Stderr, message)
 	}
-	mare.PanicIfErr(err)
-	defer historyFile.Close()
-	reader := bufio.NewReader(historyFile)
-	return history.GetHistoryFromFile(reader)
-}
-
-func prepareAndWriteHistoryToFile(historyMap history.History) {
-	historyFile := mare.ExpandUser(HistoryFile)
-	historyDirectory := path.Dir(historyFile)
-	os.MkdirAll(historyDirectory, 0700|os.ModeDir)
-	file, err := os.OpenFile(historyFile, os.O_RDWR|os.O_CREATE, 0600)
-	mare.PanicIfErr(err)
-	defer file.Close()
-	history.WriteHistoryToFile(historyMap, file)
-	file.Sync()
+	os.Exit(1)
 }
 
-func appendPasswordToHistory(passwordName string) {
-	historyMap := getHistoryMap()
-
-	history.AddToHistory(historyMap, passwordName)
-
-	prepareAndWriteHistoryToFile(historyMap)
-}
-
-func printAndAddToHistory(passwordName string) {
-	appendPasswordToHistory(passwordName)
-	fmt.Fprintln(os.Stderr, passwordName)
+// report tells how running fred on its own went, exiting with 1 if it failed.
+func report(message string, err error) {
+	if err == errCancelled {
+		return
+	} else if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	fmt.Fprintln(os.Stderr, message)
 }
 
 func main() {
-	args := os.Args[1:]
-	if len(args) > 0 {
-		passwordName := args[0]
-		printAndAddToHistory(passwordName)
-		os.Exit(1)
+	opts, err := parseOptions()
+	mare.PanicIfErr(err)
+	retv, inRofi := os.LookupEnv(RofiRetvEnvVar)
+	if opts.restoreClipboard > 0 {
+		err = restoreClipboard(opts.restoreClipboard)
+		mare.PanicIfErr(err)
+	} else if opts.typeAfter > 0 {
+		err = typeAfter(opts.typeAfter)
+		mare.PanicIfErr(err)
+	} else if opts.watch {
+		err = watchStores(opts.stores)
+		mare.PanicIfErr(err)
+	} else if opts.generate {
+		selected := ""
+		if len(opts.args) > 0 {
+			selected = opts.args[0]
+		}
+		report(generateEntry(opts, selected))
+	} else if inRofi {
+		runRofi(opts, retv)
+	} else if len(opts.args) > 1 {
+		reportAndExit(copyField(opts, opts.args[0], opts.args[1]))
+	} else if len(opts.args) > 0 {
+		reportAndExit(runAction(opts, actions[0], opts.args[0]))
+	} else if opts.launcher != nil {
+		report(runLauncher(opts))
 	} else {
-		printPasswords()
+		printPasswords(opts)
 	}
 }
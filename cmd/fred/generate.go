@@ -0,0 +1,270 @@
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/femnad/mare"
+)
+
+const (
+	DefaultPasswordLength = 24
+	DefaultWordCount      = 6
+	DefaultWordSeparator  = "-"
+	GeneratePrompt        = "new entry"
+	entryDirMode          = 0700
+	entryFileMode         = 0600
+)
+
+var characterClasses = map[string]string{
+	"lower":  "abcdefghijklmnopqrstuvwxyz",
+	"upper":  "ABCDEFGHIJKLMNOPQRSTUVWXYZ",
+	"digit":  "0123456789",
+	"symbol": "!\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~",
+}
+
+var defaultClasses = []string{"lower", "upper", "digit", "symbol"}
+
+// generatorConfig makes passwords of Length characters with at least one from each class, or
+// passphrases of Words words from a diceware wordlist when Wordlist is set.
+type generatorConfig struct {
+	Length    int      `yaml:"length"`
+	Classes   []string `yaml:"classes"`
+	Wordlist  string   `yaml:"wordlist"`
+	Words     int      `yaml:"words"`
+	Separator *string  `yaml:"separator"`
+}
+
+func (c generatorConfig) withDefaults() generatorConfig {
+	if c.Length == 0 {
+		c.Length = DefaultPasswordLength
+	}
+	if len(c.Classes) == 0 {
+		c.Classes = defaultClasses
+	}
+	if c.Words == 0 {
+		c.Words = DefaultWordCount
+	}
+	if c.Separator == nil {
+		separator := DefaultWordSeparator
+		c.Separator = &separator
+	}
+	return c
+}
+
+func randomIndex(n int) (int, error) {
+	index, err := rand.Int(rand.Reader, big.NewInt(int64(n)))
+	if err != nil {
+		return 0, err
+	}
+	return int(index.Int64()), nil
+}
+
+func containsAny(password []byte, characters string) bool {
+	for _, character := range password {
+		if strings.IndexByte(characters, character) >= 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// generateCharacters draws every character uniformly from all classes, drawing again until each
+// class shows up so that the choice among passwords that pass stays uniform.
+func generateCharacters(length int, classes []string) (string, error) {
+	alphabet := ""
+	for _, class := range classes {
+		characters, ok := characterClasses[class]
+		if !ok {
+			return "", fmt.Errorf("Unknown character class %s", class)
+		}
+		alphabet += characters
+	}
+	if length < len(classes) {
+		return "", fmt.Errorf("Length %d is too short for %d character classes", length, len(classes))
+	}
+	password := make([]byte, length)
+	for {
+		for i := range password {
+			index, err := randomIndex(len(alphabet))
+			if err != nil {
+				return "", err
+			}
+			password[i] = alphabet[index]
+		}
+		complete := true
+		for _, class := range classes {
+			complete = complete && containsAny(password, characterClasses[class])
+		}
+		if complete {
+			return string(password), nil
+		}
+	}
+}
+
+// readWordlist reads a wordlist with a word per line, taking the last column of lines such as the
+// dice rolls and words of the EFF lists.
+func readWordlist(path string) ([]string, error) {
+	file, err := os.Open(mare.ExpandUser(path))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	words := make([]string, 0)
+	seen := make(map[string]bool)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || seen[fields[len(fields)-1]] {
+			continue
+		}
+		seen[fields[len(fields)-1]] = true
+		words = append(words, fields[len(fields)-1])
+	}
+	if scanner.Err() != nil {
+		return nil, scanner.Err()
+	}
+	if len(words) < 2 {
+		return nil, fmt.Errorf("Not enough words in %s", path)
+	}
+	return words, nil
+}
+
+func generateWords(cfg generatorConfig) (string, error) {
+	wordlist, err := readWordlist(cfg.Wordlist)
+	if err != nil {
+		return "", err
+	}
+	words := make([]string, cfg.Words)
+	for i := range words {
+		index, err := randomIndex(len(wordlist))
+		if err != nil {
+			return "", err
+		}
+		words[i] = wordlist[index]
+	}
+	return strings.Join(words, *cfg.Separator), nil
+}
+
+// generatePassword rejects lengths and word counts the config gives as zero or less, only unset
+// ones being replaced with defaults.
+func generatePassword(cfg generatorConfig) (string, error) {
+	if cfg.Wordlist != "" {
+		if cfg.Words <= 0 {
+			return "", fmt.Errorf("Number of words has to be positive: %d", cfg.Words)
+		}
+		return generateWords(cfg)
+	}
+	if cfg.Length <= 0 {
+		return "", fmt.Errorf("Password length has to be positive: %d", cfg.Length)
+	}
+	return generateCharacters(cfg.Length, cfg.Classes)
+}
+
+// insertEntry encrypts content to the recipients for entry and writes it into the store, failing
+// if the entry exists.
+func insertEntry(opts options, selected selection, content string) error {
+	cleanEntry := filepath.Clean(selected.entry)
+	if filepath.IsAbs(cleanEntry) || cleanEntry == ".." || strings.HasPrefix(cleanEntry, "../") {
+		return fmt.Errorf("Entry %s is outside of the store", selected.entry)
+	}
+	recipients, err := findRecipients(selected.store.path, selected.entry)
+	if err != nil {
+		return err
+	}
+	encrypted, err := encrypt(opts.gpg, recipients, content)
+	if err != nil {
+		return err
+	}
+	gpgFile := selected.store.gpgFile(selected.entry)
+	err = os.MkdirAll(filepath.Dir(gpgFile), entryDirMode)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(gpgFile, os.O_WRONLY|os.O_CREATE|os.O_EXCL, entryFileMode)
+	if os.IsExist(err) {
+		return fmt.Errorf("%s already exists", selected.entry)
+	} else if err != nil {
+		return err
+	}
+	_, err = file.Write(encrypted)
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(gpgFile)
+	}
+	return err
+}
+
+// getEntryDirs lists the directories of the stores as suggestions for where a new entry goes.
+func getEntryDirs(stores []*passwordStore) []string {
+	dirs := make([]string, 0)
+	for _, store := range stores {
+		seen := make(map[string]bool)
+		for _, name := range getPasswordNames(store.path) {
+			dir := filepath.Dir(name)
+			if dir != "." && !seen[dir] {
+				seen[dir] = true
+				dirs = append(dirs, displayName(stores, store, dir+"/"))
+			}
+		}
+	}
+	sort.Strings(dirs)
+	return dirs
+}
+
+// generateEntry generates a password for a new entry, asking for its name through the launcher
+// unless given, commits it if the store is kept in git and copies it.
+func generateEntry(opts options, selected string) (string, error) {
+	if selected == "" {
+		if opts.launcher == nil {
+			return "", fmt.Errorf("Give the entry to generate or a launcher to ask for it")
+		}
+		var err error
+		selected, err = opts.launcher.input(GeneratePrompt, getEntryDirs(opts.stores))
+		if err != nil {
+			return "", err
+		}
+	}
+	selection, err := parseSelection(opts.stores, selected)
+	if err != nil {
+		return "", err
+	}
+	if selection.entry == "" || strings.HasSuffix(selection.entry, "/") {
+		return "", fmt.Errorf("Entry %s has no name", selected)
+	}
+	change, err := prepareChange(selection, fmt.Sprintf("Add generated password for %s.", selection.entry))
+	if err != nil {
+		return "", err
+	}
+	password, err := generatePassword(opts.generator)
+	if err != nil {
+		return "", err
+	}
+	err = insertEntry(opts, selection, password+"\n")
+	if err != nil {
+		return "", err
+	}
+	recordSelection(selection)
+	err = change.commit()
+	if err != nil {
+		return "", fmt.Errorf("Generated %s but could not commit it: %w", selection.entry, err)
+	}
+	err = copyWithTimeout(opts.clipboard, password)
+	if err != nil {
+		return "", err
+	}
+	err = change.runPostCommit(opts.git)
+	if err != nil {
+		return "", fmt.Errorf("Generated %s and copied it to clipboard, but %w", selection.entry, err)
+	}
+	return fmt.Sprintf("Generated %s and copied it to clipboard.", selection.entry), nil
+}
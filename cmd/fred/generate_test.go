@@ -0,0 +1,180 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeGpgID(t *testing.T, dir, content string) {
+	t.Helper()
+	err := os.MkdirAll(dir, 0700)
+	if err == nil {
+		err = ioutil.WriteFile(filepath.Join(dir, GpgIDFile), []byte(content), 0600)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFindRecipients(t *testing.T) {
+	storePath := t.TempDir()
+	writeGpgID(t, storePath, "root@example.com\n")
+	writeGpgID(t, filepath.Join(storePath, "team"), "# the team\nalice@example.com\nbob@example.com # backup\n")
+
+	for entry, expected := range map[string][]string{
+		"site":            {"root@example.com"},
+		"web/site":        {"root@example.com"},
+		"team/site":       {"alice@example.com", "bob@example.com"},
+		"team/deeper/web": {"alice@example.com", "bob@example.com"},
+	} {
+		recipients, err := findRecipients(storePath, entry)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(recipients, expected) {
+			t.Errorf("Expected recipients %v for %s, got %v", expected, entry, recipients)
+		}
+	}
+}
+
+func TestFindRecipientsStopsAtStoreRoot(t *testing.T) {
+	parent := t.TempDir()
+	writeGpgID(t, parent, "outside@example.com\n")
+	storePath := filepath.Join(parent, "store")
+	err := os.Mkdir(storePath, 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = findRecipients(storePath, "web/site")
+	if err == nil {
+		t.Error("Expected no recipients from outside of the store")
+	}
+
+	writeGpgID(t, filepath.Join(storePath, "empty"), "# nobody\n")
+	_, err = findRecipients(storePath, "empty/site")
+	if err == nil {
+		t.Error("Expected an error for a file without recipients")
+	}
+}
+
+func TestInsertEntryOutsideStore(t *testing.T) {
+	parent := t.TempDir()
+	storePath := filepath.Join(parent, "store")
+	writeGpgID(t, storePath, testRecipient+"\n")
+	store := &passwordStore{name: DefaultStoreName, path: storePath}
+	for _, entry := range []string{"../escaped", "web/../../escaped", "/escaped", ".."} {
+		err := insertEntry(options{gpg: DefaultGpgCommand}, selection{store: store, entry: entry}, "secret\n")
+		if err == nil || !strings.Contains(err.Error(), "outside of the store") {
+			t.Errorf("Expected %s to be rejected, got %v", entry, err)
+		}
+	}
+	files, err := ioutil.ReadDir(parent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Errorf("Expected nothing written next to the store, found %d files", len(files))
+	}
+}
+
+func TestGenerateCharactersHasEveryClass(t *testing.T) {
+	classes := []string{"lower", "digit", "symbol"}
+	alphabet := characterClasses["lower"] + characterClasses["digit"] + characterClasses["symbol"]
+	for i := 0; i < 1000; i++ {
+		password, err := generateCharacters(len(classes), classes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, class := range classes {
+			if !containsAny([]byte(password), characterClasses[class]) {
+				t.Fatalf("Expected a %s character in %q", class, password)
+			}
+		}
+		for _, character := range password {
+			if !strings.ContainsRune(alphabet, character) {
+				t.Fatalf("Unexpected character %q in %q", character, password)
+			}
+		}
+	}
+}
+
+func TestGenerateCharactersErrors(t *testing.T) {
+	_, err := generateCharacters(3, defaultClasses)
+	if err == nil {
+		t.Error("Expected an error for a length shorter than the number of classes")
+	}
+	_, err = generateCharacters(10, []string{"emoji"})
+	if err == nil {
+		t.Error("Expected an error for an unknown class")
+	}
+}
+
+func TestGenerateWords(t *testing.T) {
+	wordlist := filepath.Join(t.TempDir(), "words")
+	err := ioutil.WriteFile(wordlist, []byte("11111\tapple\n11112\tbanana\n\n11113\tcherry\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	separator := "."
+	password, err := generatePassword(generatorConfig{Wordlist: wordlist, Words: 4, Separator: &separator})
+	if err != nil {
+		t.Fatal(err)
+	}
+	words := strings.Split(password, separator)
+	if len(words) != 4 {
+		t.Fatalf("Expected 4 words in %s", password)
+	}
+	for _, word := range words {
+		if word != "apple" && word != "banana" && word != "cherry" {
+			t.Errorf("Unexpected word %s in %s", word, password)
+		}
+	}
+}
+
+func TestGenerateNonPositiveSizes(t *testing.T) {
+	for _, cfg := range []generatorConfig{
+		{Length: -1},
+		{Wordlist: "/usr/share/dict/words", Words: -1},
+	} {
+		_, err := generatePassword(cfg.withDefaults())
+		if err == nil || !strings.Contains(err.Error(), "positive") {
+			t.Errorf("Expected an error for %v, got %v", cfg, err)
+		}
+	}
+}
+
+func TestGenerateEntry(t *testing.T) {
+	setupHome(t)
+	setupGnupg(t)
+	store := newTestStore(t, nil)
+	clipboard, clipboardFile := fakeClipboard(t, "previous", 2*time.Second)
+	opts := testOptions(store, clipboard)
+	opts.generator = generatorConfig{Length: 16}.withDefaults()
+
+	_, err := generateEntry(opts, "web/new")
+	if err != nil {
+		t.Fatal(err)
+	}
+	password := readFile(t, clipboardFile)
+	if len(password) != 16 {
+		t.Errorf("Expected a password of 16 characters in the clipboard, got %q", password)
+	}
+	content, err := decrypt(DefaultGpgCommand, store.gpgFile("web/new"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if content != password+"\n" {
+		t.Errorf("Expected the entry to hold the copied password, got %q", content)
+	}
+	waitForFile(t, clipboardFile, "previous")
+
+	_, err = generateEntry(opts, "web/new")
+	if err == nil {
+		t.Error("Expected generating an existing entry to fail")
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+const gitDirName = ".git"
+
+// Paths under the git directory that exist while a merge or rebase waits for conflicts to be
+// resolved.
+var unfinishedOperations = map[string]string{
+	"MERGE_HEAD":   "merge",
+	"rebase-merge": "rebase",
+	"rebase-apply": "rebase",
+}
+
+// gitConfig holds a command run in the repository of a store after each commit, such as
+// [git, push].
+type gitConfig struct {
+	PostCommit []string `yaml:"post_commit"`
+}
+
+// storeRepo is the git repository a store, or part of it, is kept in.
+type storeRepo struct {
+	dir string
+}
+
+// findRepo looks for a repository from the directory of the entry up to the root of the store, the
+// same way pass finds the repository to commit changes to. Repositories the store itself is in are
+// not the store's to commit to.
+func findRepo(storePath, entry string) (storeRepo, bool) {
+	storePath = filepath.Clean(storePath)
+	dir := filepath.Dir(filepath.Join(storePath, entry))
+	for {
+		_, err := os.Stat(filepath.Join(dir, gitDirName))
+		if err == nil {
+			return storeRepo{dir: dir}, true
+		}
+		if dir == storePath || dir == filepath.Dir(dir) {
+			return storeRepo{}, false
+		}
+		dir = filepath.Dir(dir)
+	}
+}
+
+func (r storeRepo) git(args ...string) (string, error) {
+	var output bytes.Buffer
+	command := exec.Command("git", append([]string{"-C", r.dir}, args...)...)
+	command.Stdout = &output
+	command.Stderr = &output
+	err := command.Run()
+	if err != nil {
+		return "", fmt.Errorf("git %s failed in %s: %w: %s", args[0], r.dir, err, withoutHints(output.String()))
+	}
+	return strings.TrimSpace(output.String()), nil
+}
+
+// checkConflicts fails if the repository is in the middle of a merge or rebase or has unresolved
+// conflicts, which a commit from fred would only get tangled up in.
+func (r storeRepo) checkConflicts() error {
+	for path, operation := range unfinishedOperations {
+		gitPath, err := r.git("rev-parse", "--git-path", path)
+		if err != nil {
+			return err
+		}
+		if !filepath.IsAbs(gitPath) {
+			gitPath = filepath.Join(r.dir, gitPath)
+		}
+		_, err = os.Stat(gitPath)
+		if err == nil {
+			return fmt.Errorf("The repository of the store at %s is in the middle of a %s, finish or abort it first", r.dir, operation)
+		}
+	}
+	unmerged, err := r.git("diff", "--name-only", "--diff-filter=U")
+	if err != nil {
+		return err
+	}
+	if unmerged != "" {
+		return fmt.Errorf("The repository of the store at %s has unresolved conflicts in %s, resolve them first",
+			r.dir, strings.Join(strings.Fields(unmerged), ", "))
+	}
+	return nil
+}
+
+// signCommits tells whether commits should be signed, as pass does when pass.signcommits is set.
+func (r storeRepo) signCommits() bool {
+	sign, err := r.git("config", "--bool", "pass.signcommits")
+	return err == nil && sign == "true"
+}
+
+// commit commits the file at path, and only that file, with message.
+func (r storeRepo) commit(path, message string) error {
+	relPath, err := filepath.Rel(r.dir, path)
+	if err != nil {
+		return err
+	}
+	_, err = r.git("add", "--", relPath)
+	if err != nil {
+		return err
+	}
+	args := []string{"commit", "--message", message}
+	if r.signCommits() {
+		args = append(args, "--gpg-sign")
+	}
+	_, err = r.git(append(args, "--", relPath)...)
+	return err
+}
+
+// withoutHints drops the advice git adds to its errors, which would drown the error itself.
+func withoutHints(output string) string {
+	lines := make([]string, 0)
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		if !strings.HasPrefix(line, "hint:") {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func isRejectedPush(output string) bool {
+	for _, marker := range []string{"[rejected]", "non-fast-forward", "fetch first", "CONFLICT"} {
+		if strings.Contains(output, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// runPostCommit runs the post commit command in the repository, telling apart a remote with changes
+// of its own from other failures.
+func (r storeRepo) runPostCommit(cfg gitConfig) error {
+	if len(cfg.PostCommit) == 0 {
+		return nil
+	}
+	var output bytes.Buffer
+	command := exec.Command(cfg.PostCommit[0], cfg.PostCommit[1:]...)
+	command.Dir = r.dir
+	command.Stdout = &output
+	command.Stderr = &output
+	err := command.Run()
+	if err == nil {
+		return nil
+	}
+	if isRejectedPush(output.String()) {
+		return fmt.Errorf("%s was rejected as the remote of %s has changes not pulled yet, pull and resolve any conflicts, then push again: %s",
+			strings.Join(cfg.PostCommit, " "), r.dir, withoutHints(output.String()))
+	}
+	return fmt.Errorf("%s failed in %s: %w: %s", strings.Join(cfg.PostCommit, " "), r.dir, err,
+		withoutHints(output.String()))
+}
+
+// storeChange is a change to an entry of a store, committed the way pass commits changes if the
+// store is kept in git.
+type storeChange struct {
+	repo    storeRepo
+	inGit   bool
+	path    string
+	message string
+}
+
+// prepareChange finds the repository of the entry and makes sure a commit can go in before the
+// entry is changed.
+func prepareChange(selected selection, message string) (storeChange, error) {
+	change := storeChange{path: selected.store.gpgFile(selected.entry), message: message}
+	change.repo, change.inGit = findRepo(selected.store.path, selected.entry)
+	if !change.inGit {
+		return change, nil
+	}
+	return change, change.repo.checkConflicts()
+}
+
+func (c storeChange) commit() error {
+	if !c.inGit {
+		return nil
+	}
+	return c.repo.commit(c.path, c.message)
+}
+
+func (c storeChange) runPostCommit(cfg gitConfig) error {
+	if !c.inGit {
+		return nil
+	}
+	return c.repo.runPostCommit(cfg)
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func runGit(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	output, err := exec.Command("git", append([]string{"-C", dir}, args...)...).CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s failed: %v: %s", strings.Join(args, " "), err, output)
+	}
+	return strings.TrimSpace(string(output))
+}
+
+// setupGit gives git an identity and keeps the configuration of the user out of the tests.
+func setupGit(t *testing.T) {
+	t.Helper()
+	_, err := exec.LookPath("git")
+	if err != nil {
+		t.Skip("git is not installed")
+	}
+	setupHome(t)
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+	for _, variable := range []string{"GIT_AUTHOR", "GIT_COMMITTER"} {
+		t.Setenv(variable+"_NAME", "fred")
+		t.Setenv(variable+"_EMAIL", "fred@example.com")
+	}
+}
+
+// newGitStore clones a store from a local bare repository, returning the path of the clone and the
+// bare repository.
+func newGitStore(t *testing.T) (string, string) {
+	t.Helper()
+	dir := t.TempDir()
+	remote, storePath := filepath.Join(dir, "remote.git"), filepath.Join(dir, "store")
+	runGit(t, dir, "init", "--quiet", "--bare", remote)
+	runGit(t, dir, "clone", "--quiet", remote, storePath)
+	writeGpgID(t, storePath, testRecipient+"\n")
+	runGit(t, storePath, "add", GpgIDFile)
+	runGit(t, storePath, "commit", "--quiet", "--message", "Add recipients.")
+	runGit(t, storePath, "push", "--quiet", "--set-upstream", "origin", "HEAD")
+	return storePath, remote
+}
+
+// writeEntry changes the entry the way fred would after preparing the change.
+func writeEntry(t *testing.T, storePath, entry string) storeChange {
+	t.Helper()
+	store := &passwordStore{name: DefaultStoreName, path: storePath}
+	selected := selection{store: store, entry: entry}
+	change, err := prepareChange(selected, "Add "+entry+".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !change.inGit {
+		t.Fatalf("Expected %s to be in git", storePath)
+	}
+	gpgFile := store.gpgFile(entry)
+	err = os.MkdirAll(filepath.Dir(gpgFile), 0700)
+	if err == nil {
+		err = ioutil.WriteFile(gpgFile, []byte(entry), 0600)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return change
+}
+
+func TestCommitOnlyTheEntry(t *testing.T) {
+	setupGit(t)
+	storePath, _ := newGitStore(t)
+	err := ioutil.WriteFile(filepath.Join(storePath, "staged.gpg"), []byte("staged"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	runGit(t, storePath, "add", "staged.gpg")
+
+	err = writeEntry(t, storePath, "web/site").commit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if committed := runGit(t, storePath, "show", "--name-only", "--format=", "HEAD"); committed != "web/site.gpg" {
+		t.Errorf("Expected only the entry to be committed, got %s", committed)
+	}
+	if message := runGit(t, storePath, "log", "-1", "--format=%s"); message != "Add web/site." {
+		t.Errorf("Unexpected commit message %s", message)
+	}
+	if staged := runGit(t, storePath, "diff", "--cached", "--name-only"); staged != "staged.gpg" {
+		t.Errorf("Expected what was staged before to stay staged, got %s", staged)
+	}
+}
+
+func TestNoCommitOutsideGit(t *testing.T) {
+	store := &passwordStore{name: DefaultStoreName, path: t.TempDir()}
+	change, err := prepareChange(selection{store: store, entry: "web/site"}, "Add web/site.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if change.inGit {
+		t.Error("Expected a store without a repository not to be in git")
+	}
+	if change.commit() != nil || change.runPostCommit(gitConfig{PostCommit: []string{"false"}}) != nil {
+		t.Error("Expected nothing to run for a store without a repository")
+	}
+}
+
+func TestCommitDuringMerge(t *testing.T) {
+	setupGit(t)
+	storePath, _ := newGitStore(t)
+	head := runGit(t, storePath, "rev-parse", "HEAD")
+	err := ioutil.WriteFile(filepath.Join(storePath, gitDirName, "MERGE_HEAD"), []byte(head+"\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := &passwordStore{name: DefaultStoreName, path: storePath}
+	_, err = prepareChange(selection{store: store, entry: "web/site"}, "Add web/site.")
+	if err == nil || !strings.Contains(err.Error(), "merge") {
+		t.Errorf("Expected an unfinished merge to stop the change, got %v", err)
+	}
+}
+
+func TestPostCommitPush(t *testing.T) {
+	setupGit(t)
+	storePath, remote := newGitStore(t)
+	change := writeEntry(t, storePath, "web/site")
+	err := change.commit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = change.runPostCommit(gitConfig{PostCommit: []string{"git", "push", "--quiet"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pushed, local := runGit(t, remote, "rev-parse", "HEAD"), runGit(t, storePath, "rev-parse", "HEAD"); pushed != local {
+		t.Errorf("Expected the remote at %s, got %s", local, pushed)
+	}
+}
+
+func TestRejectedPostCommitPush(t *testing.T) {
+	setupGit(t)
+	storePath, remote := newGitStore(t)
+	other := filepath.Join(t.TempDir(), "other")
+	runGit(t, storePath, "clone", "--quiet", remote, other)
+	err := writeEntry(t, other, "web/other").commit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	runGit(t, other, "push", "--quiet")
+
+	change := writeEntry(t, storePath, "web/site")
+	err = change.commit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = change.runPostCommit(gitConfig{PostCommit: []string{"git", "push"}})
+	if err == nil || !strings.Contains(err.Error(), "pull and resolve any conflicts") {
+		t.Errorf("Expected the push to be rejected, got %v", err)
+	}
+}
+
+func TestIsRejectedPush(t *testing.T) {
+	rejected := " ! [rejected]        main -> main (fetch first)\nerror: failed to push some refs to 'remote.git'\n"
+	if !isRejectedPush(rejected) {
+		t.Error("Expected a rejected push")
+	}
+	failed := "fatal: unable to access 'https://example.com/store.git/': Could not resolve host: example.com\n"
+	if isRejectedPush(failed) {
+		t.Error("Expected an unreachable remote not to count as a rejected push")
+	}
+}
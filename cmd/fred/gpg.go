@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	DefaultGpgCommand = "gpg"
+	GpgIDFile         = ".gpg-id"
+)
+
+// decrypt returns the decrypted contents of a pass entry, the same way pass itself decrypts
+// entries. GNUPGHOME is passed on to gpg through the environment.
+func decrypt(gpgCommand, gpgFile string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	command := exec.Command(gpgCommand, "--decrypt", "--quiet", "--batch", "--yes",
+		"--compress-algo=none", "--no-encrypt-to", gpgFile)
+	command.Stdout = &stdout
+	command.Stderr = &stderr
+	err := command.Run()
+	if err != nil {
+		return "", fmt.Errorf("Error decrypting %s: %w: %s", gpgFile, err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
+
+// findRecipients reads the recipients from the .gpg-id file closest to the entry, looking up to the
+// root of the store as pass does.
+func findRecipients(storePath, entry string) ([]string, error) {
+	dir := filepath.Dir(filepath.Join(storePath, entry))
+	for {
+		content, err := ioutil.ReadFile(filepath.Join(dir, GpgIDFile))
+		if err == nil {
+			recipients := make([]string, 0)
+			for _, line := range strings.Split(string(content), "\n") {
+				line = strings.TrimSpace(strings.SplitN(line, "#", 2)[0])
+				if line != "" {
+					recipients = append(recipients, line)
+				}
+			}
+			if len(recipients) == 0 {
+				return nil, fmt.Errorf("No recipients in %s", filepath.Join(dir, GpgIDFile))
+			}
+			return recipients, nil
+		} else if !os.IsNotExist(err) {
+			return nil, err
+		}
+		if dir == filepath.Clean(storePath) || dir == filepath.Dir(dir) {
+			return nil, fmt.Errorf("No %s file found for %s in %s", GpgIDFile, entry, storePath)
+		}
+		dir = filepath.Dir(dir)
+	}
+}
+
+// encrypt encrypts content to recipients with the options pass uses.
+func encrypt(gpgCommand string, recipients []string, content string) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	args := []string{"--encrypt", "--quiet", "--batch", "--yes", "--compress-algo=none", "--no-encrypt-to"}
+	for _, recipient := range recipients {
+		args = append(args, "--recipient", recipient)
+	}
+	command := exec.Command(gpgCommand, args...)
+	command.Stdin = strings.NewReader(content)
+	command.Stdout = &stdout
+	command.Stderr = &stderr
+	err := command.Run()
+	if err != nil {
+		return nil, fmt.Errorf("Error encrypting to %s: %w: %s", strings.Join(recipients, ", "), err,
+			strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
+
+func firstLine(content string) string {
+	return strings.SplitN(content, "\n", 2)[0]
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/femnad/mare"
+	"github.com/femnad/stuff/pkg/history"
+)
+
+const (
+	HistoryFile          = "~/.config/fred/fred_history"
+	HistoryKeyEnvVar     = "FRED_HISTORY_KEY_FILE"
+	HistoryJournalEnvVar = "FRED_HISTORY_JOURNAL"
+	HistorySocketEnvVar  = "FRED_HISTORY_SOCKET"
+	RankingEnvVar        = "FRED_RANKING"
+)
+
+// getRanking picks the ranking from the command line, the environment or the config file, whichever
+// comes first.
+func getRanking(flagRanking string, cfg config) string {
+	if flagRanking != "" {
+		return flagRanking
+	}
+	envRanking := os.Getenv(RankingEnvVar)
+	if envRanking != "" {
+		return envRanking
+	}
+	return cfg.Ranking
+}
+
+// getRanker falls back to the default ranking when ranking is empty or invalid, as a mistyped
+// ranking should not keep anyone from their passwords.
+func getRanker(ranking string) history.Ranker {
+	if ranking == "" {
+		ranking = history.DefaultRanking
+	}
+	ranker, err := history.ParseRanking(ranking, time.Now())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Ignoring ranking %s: %v\n", ranking, err)
+		ranker, err = history.ParseRanking(history.DefaultRanking, time.Now())
+		mare.PanicIfErr(err)
+	}
+	return ranker
+}
+
+func reportParseError(parseError *history.ParseError) {
+	fmt.Fprintf(os.Stderr, "Skipping history line: %v\n", parseError)
+}
+
+func getHistoryCipher() *history.Cipher {
+	keyFile := os.Getenv(HistoryKeyEnvVar)
+	if keyFile == "" {
+		return nil
+	}
+	cipher, err := history.NewKeyFileCipher(mare.ExpandUser(keyFile))
+	mare.PanicIfErr(err)
+	return cipher
+}
+
+func openHistoryFile() (history.Backend, error) {
+	historyFile := mare.ExpandUser(HistoryFile)
+	store := history.NewEncryptedStore(historyFile, getHistoryCipher())
+	store.OnParseError = reportParseError
+	if os.Getenv(HistoryJournalEnvVar) != "" {
+		return history.NewJournal(store), nil
+	}
+	return store, nil
+}
+
+func getHistorySocket() string {
+	socket := os.Getenv(HistorySocketEnvVar)
+	if socket == "" {
+		return history.DefaultSocketPath()
+	}
+	return mare.ExpandUser(socket)
+}
+
+// getHistoryBackend goes through the history service when it is running and to the history file
+// otherwise.
+func getHistoryBackend() history.Backend {
+	backend, err := history.DialOrOpen(getHistorySocket(), openHistoryFile)
+	mare.PanicIfErr(err)
+	return backend
+}
+
+func getHistoryMap(backend history.Backend, namespace string) history.History {
+	historyMap, err := history.Namespace(backend, namespace).Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading history: %v\n", err)
+		return make(history.History)
+	}
+	return historyMap
+}
+
+func recordInNamespace(namespace, item string) {
+	backend := getHistoryBackend()
+	defer backend.Close()
+	err := history.Namespace(backend, namespace).Record(item, time.Now())
+	mare.PanicIfErr(err)
+}
+
+func recordSelection(selected selection) {
+	recordInNamespace(selected.store.namespace, selected.entry)
+}
+
+func recordFieldSelection(selected selection, key string) {
+	recordInNamespace(fieldNamespace(selected), key)
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/femnad/mare"
+)
+
+const (
+	CacheDir         = "~/.cache/fred"
+	indexVersion     = 1
+	indexFileMode    = 0600
+	indexDirMode     = 0700
+	watchLockSuffix  = ".watch"
+	indexFilePrefix  = "index-"
+	indexFileSuffix  = ".json"
+	indexRootDirName = "."
+	// watchedIndexMaxAge bounds how long fred trusts the index of a watched store without checking
+	// it, as inotify misses changes made by other clients of a network file system. Watchers check
+	// their stores twice as often.
+	watchedIndexMaxAge = time.Minute
+)
+
+// Directories pass keeps to itself rather than entries.
+var skippedDirs = map[string]bool{
+	".git":        true,
+	".extensions": true,
+}
+
+// indexedDir is what a directory of a store held when its modification time was modTime. A
+// directory's modification time changes whenever an entry is added to, removed from or renamed in
+// it, so an unchanged one can be taken from the index without reading it again.
+type indexedDir struct {
+	ModTime int64    `json:"mod_time"`
+	Entries []string `json:"entries"`
+	Dirs    []string `json:"dirs"`
+}
+
+type storeIndex struct {
+	Version int    `json:"version"`
+	Root    string `json:"root"`
+	// Checked is when the index was last checked against the store, in nanoseconds.
+	Checked int64                 `json:"checked"`
+	Dirs    map[string]indexedDir `json:"dirs"`
+}
+
+type fileID struct {
+	dev uint64
+	ino uint64
+}
+
+// indexWalker lists the entries of a store, reading only directories that changed since the
+// previous index. Directories are identified by device and inode so symlinks that lead back up the
+// tree, or to the same directory twice, are only followed once.
+type indexWalker struct {
+	previous storeIndex
+	current  storeIndex
+	visited  map[fileID]bool
+	changed  bool
+	names    []string
+}
+
+func getCacheDir() string {
+	cacheHome := os.Getenv("XDG_CACHE_HOME")
+	if cacheHome != "" {
+		return filepath.Join(cacheHome, "fred")
+	}
+	return mare.ExpandUser(CacheDir)
+}
+
+func getIndexPath(storePath string) string {
+	sum := sha256.Sum256([]byte(storePath))
+	return filepath.Join(getCacheDir(), indexFilePrefix+hex.EncodeToString(sum[:8])+indexFileSuffix)
+}
+
+func newStoreIndex(storePath string) storeIndex {
+	return storeIndex{Version: indexVersion, Root: storePath, Dirs: make(map[string]indexedDir)}
+}
+
+// readIndex returns an empty index for a missing, unreadable or outdated index file, the index being
+// only a cache.
+func readIndex(storePath string) storeIndex {
+	index := newStoreIndex(storePath)
+	content, err := ioutil.ReadFile(getIndexPath(storePath))
+	if err != nil {
+		return index
+	}
+	var cached storeIndex
+	err = json.Unmarshal(content, &cached)
+	if err != nil || cached.Version != indexVersion || cached.Root != storePath || cached.Dirs == nil {
+		return index
+	}
+	return cached
+}
+
+func writeIndex(index storeIndex) error {
+	content, err := json.Marshal(index)
+	if err != nil {
+		return err
+	}
+	indexPath := getIndexPath(index.Root)
+	err = os.MkdirAll(filepath.Dir(indexPath), indexDirMode)
+	if err != nil {
+		return err
+	}
+	tempFile, err := ioutil.TempFile(filepath.Dir(indexPath), filepath.Base(indexPath)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tempFile.Name())
+	_, err = tempFile.Write(content)
+	closeErr := tempFile.Close()
+	if err != nil {
+		return err
+	}
+	if closeErr != nil {
+		return closeErr
+	}
+	return os.Rename(tempFile.Name(), indexPath)
+}
+
+func getFileID(info os.FileInfo) (fileID, bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return fileID{}, false
+	}
+	return fileID{dev: uint64(stat.Dev), ino: uint64(stat.Ino)}, true
+}
+
+// readIndexedDir reads a directory, following symlinks and skipping the ones that are broken.
+func readIndexedDir(path string, modTime int64) (indexedDir, error) {
+	dirContent, err := ioutil.ReadDir(path)
+	if err != nil {
+		return indexedDir{}, err
+	}
+	dir := indexedDir{ModTime: modTime, Entries: make([]string, 0), Dirs: make([]string, 0)}
+	for _, info := range dirContent {
+		name := info.Name()
+		if info.Mode()&os.ModeSymlink != 0 {
+			info, err = os.Stat(filepath.Join(path, name))
+			if err != nil {
+				continue
+			}
+		}
+		switch {
+		case info.IsDir():
+			if !skippedDirs[name] {
+				dir.Dirs = append(dir.Dirs, name)
+			}
+		case info.Mode().IsRegular() && isGpgFile(name):
+			dir.Entries = append(dir.Entries, strings.TrimSuffix(name, GpgFileExtension))
+		}
+	}
+	return dir, nil
+}
+
+func indexKey(relPath string) string {
+	if relPath == "" {
+		return indexRootDirName
+	}
+	return relPath
+}
+
+func (w *indexWalker) walk(path, relPath string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	id, ok := getFileID(info)
+	if ok {
+		if w.visited[id] {
+			return nil
+		}
+		w.visited[id] = true
+	}
+
+	key := indexKey(relPath)
+	modTime := info.ModTime().UnixNano()
+	dir, cached := w.previous.Dirs[key]
+	if !cached || dir.ModTime != modTime {
+		dir, err = readIndexedDir(path, modTime)
+		if err != nil {
+			return err
+		}
+		w.changed = true
+	}
+	w.current.Dirs[key] = dir
+
+	for _, entry := range dir.Entries {
+		w.names = append(w.names, filepath.Join(relPath, entry))
+	}
+	for _, subDir := range dir.Dirs {
+		err = w.walk(filepath.Join(path, subDir), filepath.Join(relPath, subDir))
+		if os.IsNotExist(err) {
+			// Gone since the directory was read, the next walk reads the directory again.
+			w.changed = true
+			continue
+		} else if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// names lists the entries of an index as they were when it was written.
+func (index storeIndex) names() []string {
+	names := make([]string, 0)
+	var collect func(relPath string)
+	collect = func(relPath string) {
+		// Directories only in the index if they were walked, so links that were not followed end here.
+		dir, ok := index.Dirs[indexKey(relPath)]
+		if !ok {
+			return
+		}
+		for _, entry := range dir.Entries {
+			names = append(names, filepath.Join(relPath, entry))
+		}
+		for _, subDir := range dir.Dirs {
+			collect(filepath.Join(relPath, subDir))
+		}
+	}
+	collect("")
+	return names
+}
+
+// refreshIndex brings the index of a store up to date, writing it back if anything changed, or
+// regardless if recordCheck is set, to keep the time it was checked.
+func refreshIndex(storePath string, recordCheck bool) (storeIndex, []string, error) {
+	walker := indexWalker{
+		previous: readIndex(storePath),
+		current:  newStoreIndex(storePath),
+		visited:  make(map[fileID]bool),
+	}
+	walker.current.Checked = time.Now().UnixNano()
+	err := walker.walk(storePath, "")
+	if err != nil {
+		return storeIndex{}, nil, err
+	}
+	if recordCheck || walker.changed || len(walker.current.Dirs) != len(walker.previous.Dirs) {
+		err = writeIndex(walker.current)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing index of %s: %v\n", storePath, err)
+		}
+	}
+	return walker.current, walker.names, nil
+}
+
+// isWatched tells whether a watcher keeps the index of a store up to date, by finding the lock the
+// watcher holds.
+func isWatched(storePath string) bool {
+	lockFile, err := os.Open(getIndexPath(storePath) + watchLockSuffix)
+	if err != nil {
+		return false
+	}
+	defer lockFile.Close()
+	err = syscall.Flock(int(lockFile.Fd()), syscall.LOCK_SH|syscall.LOCK_NB)
+	if err != nil {
+		return err == syscall.EWOULDBLOCK
+	}
+	syscall.Flock(int(lockFile.Fd()), syscall.LOCK_UN)
+	return false
+}
+
+// listEntries lists the entries of a store, trusting the index as is when a watcher has checked it
+// recently and checking it against the store otherwise.
+func listEntries(storePath string) ([]string, error) {
+	var names []string
+	index := readIndex(storePath)
+	checkedAgo := time.Since(time.Unix(0, index.Checked))
+	if isWatched(storePath) && len(index.Dirs) > 0 && checkedAgo < watchedIndexMaxAge {
+		names = index.names()
+	} else {
+		var err error
+		_, names, err = refreshIndex(storePath, false)
+		if err != nil {
+			return nil, err
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func writeStoreFiles(t *testing.T, storePath string, files ...string) {
+	t.Helper()
+	for _, file := range files {
+		path := filepath.Join(storePath, file)
+		err := os.MkdirAll(filepath.Dir(path), 0700)
+		if err == nil {
+			err = ioutil.WriteFile(path, []byte(file), 0600)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func symlink(t *testing.T, target, path string) {
+	t.Helper()
+	err := os.Symlink(target, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func expectEntries(t *testing.T, storePath string, expected ...string) {
+	t.Helper()
+	names, err := listEntries(storePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("Expected entries %v, got %v", expected, names)
+	}
+}
+
+// touchDir moves the modification time of a directory, as changes within the same clock tick
+// might leave it as it was.
+func touchDir(t *testing.T, path string, modTime time.Time) {
+	t.Helper()
+	err := os.Chtimes(path, modTime, modTime)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestIndexSkipsPassDirs(t *testing.T) {
+	setupHome(t)
+	storePath := t.TempDir()
+	writeStoreFiles(t, storePath, "web/site.gpg", "mail.gpg", "notes.txt", GpgIDFile,
+		".git/objects/secret.gpg", ".extensions/ext.gpg", "web/.git/other.gpg")
+	expectEntries(t, storePath, "mail", "web/site")
+}
+
+func TestIndexSymlinks(t *testing.T) {
+	setupHome(t)
+	storePath := t.TempDir()
+	writeStoreFiles(t, storePath, "web/site.gpg", "shared/vpn.gpg")
+	symlink(t, storePath, filepath.Join(storePath, "web", "loop"))
+	symlink(t, filepath.Join(storePath, "missing"), filepath.Join(storePath, "broken"))
+	symlink(t, filepath.Join(storePath, "missing.gpg"), filepath.Join(storePath, "broken.gpg"))
+	symlink(t, filepath.Join(storePath, "web", "site.gpg"), filepath.Join(storePath, "alias.gpg"))
+	expectEntries(t, storePath, "alias", "shared/vpn", "web/site")
+
+	// A directory linked from outside of the store is followed.
+	outside := t.TempDir()
+	writeStoreFiles(t, outside, "team.gpg")
+	symlink(t, outside, filepath.Join(storePath, "team"))
+	expectEntries(t, storePath, "alias", "shared/vpn", "team/team", "web/site")
+}
+
+func TestIndexRereadsChangedDirs(t *testing.T) {
+	setupHome(t)
+	storePath := t.TempDir()
+	writeStoreFiles(t, storePath, "web/site.gpg", "mail.gpg")
+	modTime := time.Now().Add(-time.Hour)
+	touchDir(t, filepath.Join(storePath, "web"), modTime)
+	expectEntries(t, storePath, "mail", "web/site")
+
+	// A directory is taken from the index while its modification time stays the same.
+	writeStoreFiles(t, storePath, "web/shop.gpg")
+	touchDir(t, filepath.Join(storePath, "web"), modTime)
+	expectEntries(t, storePath, "mail", "web/site")
+
+	touchDir(t, filepath.Join(storePath, "web"), modTime.Add(time.Second))
+	expectEntries(t, storePath, "mail", "web/shop", "web/site")
+	index := readIndex(storePath)
+	if entries := index.Dirs["web"].Entries; !reflect.DeepEqual(entries, []string{"shop", "site"}) {
+		t.Errorf("Expected the index to be updated, got %v", entries)
+	}
+
+	err := os.RemoveAll(filepath.Join(storePath, "web"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectEntries(t, storePath, "mail")
+}
+
+func TestWatchedIndexIsChecked(t *testing.T) {
+	setupHome(t)
+	storePath := t.TempDir()
+	writeStoreFiles(t, storePath, "web/site.gpg")
+	_, _, err := refreshIndex(storePath, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lockFile, err := os.OpenFile(getIndexPath(storePath)+watchLockSuffix, os.O_RDWR|os.O_CREATE, indexFileMode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lockFile.Close()
+	err = syscall.Flock(int(lockFile.Fd()), syscall.LOCK_EX)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !isWatched(storePath) {
+		t.Fatal("Expected the store to be watched")
+	}
+
+	// Say a teammate adds an entry through another client of a network file system.
+	writeStoreFiles(t, storePath, "web/shop.gpg")
+	touchDir(t, filepath.Join(storePath, "web"), time.Now().Add(time.Hour))
+	expectEntries(t, storePath, "web/site")
+
+	index := readIndex(storePath)
+	index.Checked = time.Now().Add(-watchedIndexMaxAge).UnixNano()
+	err = writeIndex(index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectEntries(t, storePath, "web/shop", "web/site")
+}
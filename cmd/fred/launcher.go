@@ -0,0 +1,284 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	LauncherPrompt  = "pass"
+	fzfKeyPrefix    = "alt-"
+	fzfCancelled    = 130
+	launcherNoMatch = 1
+)
+
+var errCancelled = errors.New("Cancelled")
+
+// pick is what a launcher returned: the picked item and the custom key it was picked with, if any.
+type pick struct {
+	item string
+	key  int
+}
+
+// launcher runs a menu program that reads items from its standard input and prints the picked one.
+type launcher struct {
+	// args returns the arguments for a menu with prompt and message, binding custom keys if the
+	// launcher has them.
+	args func(prompt, message string) []string
+	// readPick makes a pick of the output and exit code of a launcher that did not fail.
+	readPick func(output string, exitCode int) (pick, error)
+	// inputArgs and readInput are the same for a menu that takes text typed in as well as the items.
+	inputArgs func(prompt string) []string
+	readInput func(output string, exitCode int) (string, error)
+}
+
+type launcherConfig struct {
+	Name string `yaml:"name"`
+	// Command is run instead of a known launcher when given, without prompts or custom keys.
+	Command []string `yaml:"command"`
+}
+
+func readPlainPick(output string, exitCode int) (pick, error) {
+	if exitCode == launcherNoMatch {
+		return pick{}, errCancelled
+	}
+	return pick{item: strings.TrimRight(output, "\n")}, nil
+}
+
+func readPlainInput(output string, exitCode int) (string, error) {
+	picked, err := readPlainPick(output, exitCode)
+	if err == nil && exitCode != 0 {
+		return "", fmt.Errorf("Launcher exited with %d", exitCode)
+	}
+	return picked.item, err
+}
+
+func readRofiPick(output string, exitCode int) (pick, error) {
+	if exitCode >= rofiFirstCustomKey {
+		return pick{item: strings.TrimRight(output, "\n"), key: getRofiKey(exitCode)}, nil
+	}
+	return readPlainPick(output, exitCode)
+}
+
+func fzfKeys() string {
+	keys := make([]string, 0, showFieldsKey)
+	for key := 1; key <= showFieldsKey; key++ {
+		keys = append(keys, fzfKeyPrefix+strconv.Itoa(key))
+	}
+	return strings.Join(keys, ",")
+}
+
+// readFzfPick reads the key fzf prints before the pick when given --expect.
+func readFzfPick(output string, exitCode int) (pick, error) {
+	if exitCode == launcherNoMatch || exitCode == fzfCancelled {
+		return pick{}, errCancelled
+	}
+	lines := strings.SplitN(strings.TrimRight(output, "\n"), "\n", 2)
+	if len(lines) < 2 {
+		return pick{}, errCancelled
+	}
+	key := pickKey
+	if lines[0] != "" {
+		var err error
+		key, err = strconv.Atoi(strings.TrimPrefix(lines[0], fzfKeyPrefix))
+		if err != nil {
+			return pick{}, fmt.Errorf("Unexpected fzf key %s", lines[0])
+		}
+	}
+	return pick{item: lines[1], key: key}, nil
+}
+
+// readFzfInput reads the query fzf prints first when given --print-query, taking the pick instead if
+// there is one.
+func readFzfInput(output string, exitCode int) (string, error) {
+	if exitCode == fzfCancelled {
+		return "", errCancelled
+	}
+	lines := strings.Split(strings.TrimRight(output, "\n"), "\n")
+	if len(lines) > 1 && lines[1] != "" {
+		return lines[1], nil
+	}
+	return lines[0], nil
+}
+
+var launchers = map[string]launcher{
+	"rofi": {
+		args: func(prompt, message string) []string {
+			args := []string{"rofi", "-dmenu", "-i", "-no-custom", "-p", prompt}
+			if message != "" {
+				args = append(args, "-mesg", message)
+			}
+			return args
+		},
+		readPick: readRofiPick,
+		inputArgs: func(prompt string) []string {
+			return []string{"rofi", "-dmenu", "-i", "-p", prompt}
+		},
+		readInput: readPlainInput,
+	},
+	"dmenu": {
+		args: func(prompt, message string) []string {
+			return []string{"dmenu", "-i", "-p", prompt}
+		},
+		readPick: readPlainPick,
+		inputArgs: func(prompt string) []string {
+			return []string{"dmenu", "-i", "-p", prompt}
+		},
+		readInput: readPlainInput,
+	},
+	"wofi": {
+		args: func(prompt, message string) []string {
+			return []string{"wofi", "--dmenu", "--insensitive", "--prompt", prompt}
+		},
+		readPick: readPlainPick,
+		inputArgs: func(prompt string) []string {
+			return []string{"wofi", "--dmenu", "--insensitive", "--prompt", prompt}
+		},
+		readInput: readPlainInput,
+	},
+	"bemenu": {
+		args: func(prompt, message string) []string {
+			return []string{"bemenu", "-i", "-p", prompt}
+		},
+		readPick: readPlainPick,
+		inputArgs: func(prompt string) []string {
+			return []string{"bemenu", "-i", "-p", prompt}
+		},
+		readInput: readPlainInput,
+	},
+	"fzf": {
+		args: func(prompt, message string) []string {
+			args := []string{"fzf", "--no-sort", "--prompt", prompt + "> ", "--expect", fzfKeys()}
+			if message != "" {
+				args = append(args, "--header", message)
+			}
+			return args
+		},
+		readPick: readFzfPick,
+		inputArgs: func(prompt string) []string {
+			return []string{"fzf", "--print-query", "--prompt", prompt + "> "}
+		},
+		readInput: readFzfInput,
+	},
+}
+
+func launcherNames() []string {
+	names := make([]string, 0, len(launchers))
+	for name := range launchers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func getLauncher(cfg launcherConfig) (launcher, error) {
+	if len(cfg.Command) == 0 {
+		named, ok := launchers[cfg.Name]
+		if !ok {
+			return launcher{}, fmt.Errorf("Unknown launcher %s, known launchers are %s", cfg.Name,
+				strings.Join(launcherNames(), ", "))
+		}
+		return named, nil
+	}
+	return launcher{
+		args: func(prompt, message string) []string {
+			return cfg.Command
+		},
+		readPick: readPlainPick,
+		inputArgs: func(prompt string) []string {
+			return cfg.Command
+		},
+		readInput: readPlainInput,
+	}, nil
+}
+
+// runMenu runs a launcher with items as its input. Terminal launchers such as fzf draw on the
+// terminal, so standard error is left to them.
+func runMenu(args []string, items []string) (string, int, error) {
+	var stdout bytes.Buffer
+	command := exec.Command(args[0], args[1:]...)
+	command.Stdin = strings.NewReader(strings.Join(items, "\n") + "\n")
+	command.Stdout = &stdout
+	command.Stderr = os.Stderr
+	err := command.Run()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			return "", 0, fmt.Errorf("Error running %s: %w", args[0], err)
+		}
+		return stdout.String(), exitErr.ExitCode(), nil
+	}
+	return stdout.String(), 0, nil
+}
+
+// run shows items in the launcher and returns what was picked.
+func (l launcher) run(prompt, message string, items []string) (pick, error) {
+	args := l.args(prompt, message)
+	output, exitCode, err := runMenu(args, items)
+	if err != nil {
+		return pick{}, err
+	}
+	picked, err := l.readPick(output, exitCode)
+	if err != nil {
+		return pick{}, err
+	}
+	if exitCode != 0 && picked.key == pickKey {
+		return pick{}, fmt.Errorf("%s exited with %d", args[0], exitCode)
+	}
+	return picked, nil
+}
+
+// input shows items in the launcher as suggestions and returns what was picked or typed in.
+func (l launcher) input(prompt string, items []string) (string, error) {
+	args := l.inputArgs(prompt)
+	output, exitCode, err := runMenu(args, items)
+	if err != nil {
+		return "", err
+	}
+	input, err := l.readInput(output, exitCode)
+	if err != nil {
+		return "", err
+	}
+	if input == "" {
+		return "", errCancelled
+	}
+	return input, nil
+}
+
+func pickField(opts options, selected string) (string, error) {
+	selection, err := parseSelection(opts.stores, selected)
+	if err != nil {
+		return "", err
+	}
+	entry, err := getEntryFields(opts, selection)
+	if err != nil {
+		return "", err
+	}
+	picked, err := opts.launcher.run(selected, "", getOrderedFields(opts, selection, entry))
+	if err != nil {
+		return "", err
+	}
+	return copyField(opts, selected, picked.item)
+}
+
+// runLauncher lets the user pick an entry and what to do with it through the launcher.
+func runLauncher(opts options) (string, error) {
+	picked, err := opts.launcher.run(LauncherPrompt, keyHelp("Alt+%d %s"), getOrderedPasswords(opts.stores, opts.ranking))
+	if err != nil {
+		return "", err
+	}
+	if picked.key == showFieldsKey {
+		return pickField(opts, picked.item)
+	}
+	act, err := getKeyAction(picked.key)
+	if err != nil {
+		return "", err
+	}
+	return runAction(opts, act, picked.item)
+}
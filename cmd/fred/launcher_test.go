@@ -0,0 +1,191 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeLauncher puts a launcher called name first in the path, which prints output and exits with
+// exitCode. It returns the files its arguments, one per line, and its input end up in.
+func fakeLauncher(t *testing.T, name, output string, exitCode int) (string, string) {
+	t.Helper()
+	dir := t.TempDir()
+	argsFile, inputFile := filepath.Join(dir, "args"), filepath.Join(dir, "input")
+	script := fmt.Sprintf("#!/bin/sh\nprintf '%%s\\n' \"$@\" > %s\ncat > %s\nprintf '%%s' '%s'\nexit %d\n",
+		argsFile, inputFile, output, exitCode)
+	err := ioutil.WriteFile(filepath.Join(dir, name), []byte(script), 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return argsFile, inputFile
+}
+
+func TestReadFzfPick(t *testing.T) {
+	for _, c := range []struct {
+		output   string
+		exitCode int
+		expected pick
+		err      error
+	}{
+		{"\nweb/site\n", 0, pick{item: "web/site", key: pickKey}, nil},
+		{"alt-2\nweb/site\n", 0, pick{item: "web/site", key: 2}, nil},
+		{"alt-5\nweb/site\n", 0, pick{item: "web/site", key: showFieldsKey}, nil},
+		{"\n", 1, pick{}, errCancelled},
+		{"", 130, pick{}, errCancelled},
+		{"alt-1\n", 0, pick{}, errCancelled},
+	} {
+		picked, err := readFzfPick(c.output, c.exitCode)
+		if picked != c.expected || err != c.err {
+			t.Errorf("Expected %v, %v for %q and %d, got %v, %v", c.expected, c.err, c.output, c.exitCode,
+				picked, err)
+		}
+	}
+	_, err := readFzfPick("ctrl-x\nweb/site\n", 0)
+	if err == nil {
+		t.Error("Expected an error for an unexpected key")
+	}
+}
+
+func TestReadRofiPick(t *testing.T) {
+	for _, c := range []struct {
+		output   string
+		exitCode int
+		expected pick
+		err      error
+	}{
+		{"web/site\n", 0, pick{item: "web/site", key: pickKey}, nil},
+		{"web/site\n", rofiFirstCustomKey, pick{item: "web/site", key: 1}, nil},
+		{"web/site\n", rofiFirstCustomKey + 4, pick{item: "web/site", key: 5}, nil},
+		{"", 1, pick{}, errCancelled},
+	} {
+		picked, err := readRofiPick(c.output, c.exitCode)
+		if picked != c.expected || err != c.err {
+			t.Errorf("Expected %v, %v for %q and %d, got %v, %v", c.expected, c.err, c.output, c.exitCode,
+				picked, err)
+		}
+	}
+}
+
+func TestReadFzfInput(t *testing.T) {
+	for _, c := range []struct {
+		output   string
+		exitCode int
+		expected string
+		err      error
+	}{
+		{"new/entry\n", 1, "new/entry", nil},
+		{"we\nweb/site\n", 0, "web/site", nil},
+		{"we\n\n", 0, "we", nil},
+		{"", 1, "", nil},
+		{"typed\n", 130, "", errCancelled},
+	} {
+		input, err := readFzfInput(c.output, c.exitCode)
+		if input != c.expected || err != c.err {
+			t.Errorf("Expected %q, %v for %q and %d, got %q, %v", c.expected, c.err, c.output, c.exitCode,
+				input, err)
+		}
+	}
+}
+
+func TestFzfLauncher(t *testing.T) {
+	argsFile, inputFile := fakeLauncher(t, "fzf", "alt-3\nweb/site\n", 0)
+	fzf, err := getLauncher(launcherConfig{Name: "fzf"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	picked, err := fzf.run(LauncherPrompt, "help", []string{"web/site", "mail"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if picked != (pick{item: "web/site", key: 3}) {
+		t.Errorf("Unexpected pick %v", picked)
+	}
+	if input := readFile(t, inputFile); input != "web/site\nmail\n" {
+		t.Errorf("Unexpected launcher input %q", input)
+	}
+	args := readFile(t, argsFile)
+	if !strings.Contains(args, "--expect\n"+fzfKeys()+"\n") || !strings.Contains(args, "--header\nhelp\n") {
+		t.Errorf("Unexpected launcher arguments %q", args)
+	}
+}
+
+func TestCancelledLaunchers(t *testing.T) {
+	for _, c := range []struct {
+		name     string
+		exitCode int
+	}{
+		{"fzf", 130},
+		{"fzf", 1},
+		{"rofi", 1},
+		{"dmenu", 1},
+	} {
+		fakeLauncher(t, c.name, "", c.exitCode)
+		named, err := getLauncher(launcherConfig{Name: c.name})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = named.run(LauncherPrompt, "", []string{"web/site"})
+		if err != errCancelled {
+			t.Errorf("Expected %s exiting with %d to cancel, got %v", c.name, c.exitCode, err)
+		}
+	}
+}
+
+func TestFailingLauncher(t *testing.T) {
+	fakeLauncher(t, "dmenu", "web/site\n", 2)
+	dmenu, err := getLauncher(launcherConfig{Name: "dmenu"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = dmenu.run(LauncherPrompt, "", []string{"web/site"})
+	if err == nil || err == errCancelled {
+		t.Errorf("Expected dmenu exiting with 2 to fail, got %v", err)
+	}
+}
+
+func TestCommandLauncherInput(t *testing.T) {
+	argsFile, _ := fakeLauncher(t, "menu", "new/entry\n", 0)
+	command, err := getLauncher(launcherConfig{Command: []string{"menu", "--flag"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	input, err := command.input(LauncherPrompt, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if input != "new/entry" {
+		t.Errorf("Unexpected input %q", input)
+	}
+	if args := readFile(t, argsFile); args != "--flag\n" {
+		t.Errorf("Unexpected launcher arguments %q", args)
+	}
+}
+
+func TestRunLauncherCopiesUsername(t *testing.T) {
+	setupHome(t)
+	setupGnupg(t)
+	store := newTestStore(t, map[string]string{"web/site": "secret\nuser: me\n"})
+	clipboard, clipboardFile := fakeClipboard(t, "previous", 2*time.Second)
+	fakeLauncher(t, "fzf", "alt-1\nweb/site\n", 0)
+	fzf, err := getLauncher(launcherConfig{Name: "fzf"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := testOptions(store, clipboard)
+	opts.launcher = &fzf
+
+	_, err = runLauncher(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if content := readFile(t, clipboardFile); content != "me" {
+		t.Errorf("Expected the username in the clipboard, got %q", content)
+	}
+	waitForFile(t, clipboardFile, "previous")
+}
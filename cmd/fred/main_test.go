@@ -0,0 +1,188 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	testMainEnvVar = "FRED_TEST_MAIN"
+	testRecipient  = "fred-test@example.com"
+)
+
+// TestMain lets the test binary stand in for fred when it starts itself detached.
+func TestMain(m *testing.M) {
+	if os.Getenv(testMainEnvVar) != "" {
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// setupHome points fred at a temporary home so that its history and index stay out of the way, and
+// lets detached copies of the test binary run fred.
+func setupHome(t *testing.T) string {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CACHE_HOME", filepath.Join(home, ".cache"))
+	t.Setenv(HistorySocketEnvVar, filepath.Join(home, "history.sock"))
+	t.Setenv(testMainEnvVar, "1")
+	return home
+}
+
+// setupGnupg creates a throwaway GnuPG home with a key for testRecipient.
+func setupGnupg(t *testing.T) {
+	t.Helper()
+	_, err := exec.LookPath(DefaultGpgCommand)
+	if err != nil {
+		t.Skip("gpg is not installed")
+	}
+	gnupgHome, err := ioutil.TempDir("", "fred-gnupg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		exec.Command("gpgconf", "--kill", "gpg-agent").Run()
+		os.RemoveAll(gnupgHome)
+	})
+	t.Setenv("GNUPGHOME", gnupgHome)
+	output, err := exec.Command(DefaultGpgCommand, "--batch", "--passphrase", "", "--quick-gen-key",
+		testRecipient, "default", "default", "never").CombinedOutput()
+	if err != nil {
+		t.Fatalf("Error generating key: %v: %s", err, output)
+	}
+}
+
+func newTestStore(t *testing.T, entries map[string]string) *passwordStore {
+	t.Helper()
+	storePath := t.TempDir()
+	err := ioutil.WriteFile(filepath.Join(storePath, GpgIDFile), []byte(testRecipient+"\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := &passwordStore{name: DefaultStoreName, path: storePath}
+	for entry, content := range entries {
+		encrypted, err := encrypt(DefaultGpgCommand, []string{testRecipient}, content)
+		if err != nil {
+			t.Fatal(err)
+		}
+		gpgFile := store.gpgFile(entry)
+		err = os.MkdirAll(filepath.Dir(gpgFile), 0700)
+		if err == nil {
+			err = ioutil.WriteFile(gpgFile, encrypted, 0600)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return store
+}
+
+// fakeClipboard keeps the clipboard in a file.
+func fakeClipboard(t *testing.T, content string, timeout time.Duration) (clipboardConfig, string) {
+	t.Helper()
+	clipboardFile := filepath.Join(t.TempDir(), "clipboard")
+	err := ioutil.WriteFile(clipboardFile, []byte(content), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := clipboardConfig{
+		Copy:    []string{"sh", "-c", "cat > " + clipboardFile},
+		Paste:   []string{"cat", clipboardFile},
+		Timeout: timeout,
+	}
+	return cfg, clipboardFile
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(content)
+}
+
+// waitForFile waits for the file at path to hold want, as detached processes write it later.
+func waitForFile(t *testing.T, path, want string) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	var got string
+	for time.Now().Before(deadline) {
+		content, err := ioutil.ReadFile(path)
+		got = string(content)
+		if err == nil && got == want {
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	t.Fatalf("Expected %s to hold %q, got %q", path, want, got)
+}
+
+func testOptions(store *passwordStore, clipboard clipboardConfig) options {
+	return options{
+		stores:    []*passwordStore{store},
+		clipboard: clipboard,
+		gpg:       DefaultGpgCommand,
+	}
+}
+
+func TestCopyPasswordRestoresClipboard(t *testing.T) {
+	setupHome(t)
+	setupGnupg(t)
+	store := newTestStore(t, map[string]string{"web/site": "secret\nuser: me\n"})
+	clipboard, clipboardFile := fakeClipboard(t, "previous", 500*time.Millisecond)
+
+	message, err := runAction(testOptions(store, clipboard), actions[0], "web/site")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(message, "web/site") {
+		t.Errorf("Unexpected message %q", message)
+	}
+	if got := readFile(t, clipboardFile); got != "secret" {
+		t.Errorf("Expected the password in the clipboard, got %q", got)
+	}
+	waitForFile(t, clipboardFile, "previous")
+}
+
+func TestCopyPasswordLeavesChangedClipboard(t *testing.T) {
+	setupHome(t)
+	setupGnupg(t)
+	store := newTestStore(t, map[string]string{"site": "secret\n"})
+	clipboard, clipboardFile := fakeClipboard(t, "previous", 500*time.Millisecond)
+
+	_, err := runAction(testOptions(store, clipboard), actions[0], "site")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(clipboardFile, []byte("copied since"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(2 * time.Second)
+	if got := readFile(t, clipboardFile); got != "copied since" {
+		t.Errorf("Expected the clipboard to be left alone, got %q", got)
+	}
+}
+
+func TestCopyPasswordOfMissingEntry(t *testing.T) {
+	setupHome(t)
+	setupGnupg(t)
+	store := newTestStore(t, nil)
+	clipboard, clipboardFile := fakeClipboard(t, "previous", time.Second)
+
+	_, err := runAction(testOptions(store, clipboard), actions[0], "missing")
+	if err == nil {
+		t.Fatal("Expected an error for a missing entry")
+	}
+	if got := readFile(t, clipboardFile); got != "previous" {
+		t.Errorf("Expected the clipboard to be left alone, got %q", got)
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// See rofi-script(5) for the protocol fred speaks when rofi runs it as a script mode.
+const (
+	RofiRetvEnvVar = "ROFI_RETV"
+	RofiInfoEnvVar = "ROFI_INFO"
+	RofiDataEnvVar = "ROFI_DATA"
+
+	rofiInitialCall    = 0
+	rofiSelectedEntry  = 1
+	rofiCustomEntry    = 2
+	rofiFirstCustomKey = 10
+
+	rofiOptionStart     = "\x00"
+	rofiOptionSeparator = "\x1f"
+	rofiPrompt          = "pass"
+	rofiIcon            = "dialog-password"
+	rofiFieldIcon       = "text-x-generic"
+
+	// NotifyCommand shows action messages once rofi has closed, being called with a summary and
+	// the message.
+	NotifyCommand = "notify-send"
+	notifySummary = "fred"
+)
+
+var markupEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+func rofiOptions(keysAndValues ...string) string {
+	return strings.Join(keysAndValues, rofiOptionSeparator)
+}
+
+func printRofiModeOption(key, value string) {
+	fmt.Printf("%s%s\n", rofiOptionStart, rofiOptions(key, value))
+}
+
+// printRofiMenu lists the entries for rofi, with message shown above them in place of the key
+// help if not empty.
+func printRofiMenu(opts options, message string) {
+	if message == "" {
+		message = keyHelp("<b>Alt+%d</b> %s")
+	}
+	printRofiModeOption("prompt", rofiPrompt)
+	printRofiModeOption("message", message)
+	printRofiModeOption("use-hot-keys", "true")
+	printRofiModeOption("no-custom", "true")
+	for _, name := range getOrderedPasswords(opts.stores, opts.ranking) {
+		fmt.Printf("%s%s%s\n", name, rofiOptionStart, rofiOptions("info", name, "icon", rofiIcon))
+	}
+}
+
+// printRofiFieldMenu lists the fields of an entry for rofi, keeping the entry in the mode data so
+// the next call knows a field was picked.
+func printRofiFieldMenu(opts options, selected string) error {
+	selection, err := parseSelection(opts.stores, selected)
+	if err != nil {
+		return err
+	}
+	entry, err := getEntryFields(opts, selection)
+	if err != nil {
+		return err
+	}
+	printRofiModeOption("prompt", selected)
+	printRofiModeOption("data", selected)
+	printRofiModeOption("no-custom", "true")
+	for _, key := range getOrderedFields(opts, selection, entry) {
+		fmt.Printf("%s%s%s\n", key, rofiOptionStart, rofiOptions("info", key, "icon", rofiFieldIcon))
+	}
+	return nil
+}
+
+func getRofiKey(retv int) int {
+	if retv == rofiSelectedEntry {
+		return pickKey
+	}
+	return retv - rofiFirstCustomKey + 1
+}
+
+// runRofi handles one call from rofi. Rofi closes when fred lists nothing after a pick, so errors
+// bring the menu back up with the error in the message.
+func runRofi(opts options, retvValue string) {
+	retv, err := strconv.Atoi(retvValue)
+	if err != nil {
+		printRofiMenu(opts, markupEscaper.Replace(fmt.Sprintf("Invalid %s: %s", RofiRetvEnvVar, retvValue)))
+		return
+	}
+	if retv == rofiInitialCall {
+		printRofiMenu(opts, "")
+		return
+	}
+	if retv == rofiCustomEntry || len(opts.args) == 0 {
+		printRofiMenu(opts, "Pick one of the entries")
+		return
+	}
+
+	selected := os.Getenv(RofiInfoEnvVar)
+	if selected == "" {
+		selected = opts.args[0]
+	}
+	entry := os.Getenv(RofiDataEnvVar)
+	if entry != "" {
+		err = runRofiFieldPick(opts, retv, entry, selected)
+		if err != nil {
+			printRofiMenu(opts, markupEscaper.Replace(err.Error()))
+		}
+		return
+	}
+	key := getRofiKey(retv)
+	if key == showFieldsKey {
+		err = printRofiFieldMenu(opts, selected)
+		if err != nil {
+			printRofiMenu(opts, markupEscaper.Replace(err.Error()))
+		}
+		return
+	}
+
+	act, err := getKeyAction(key)
+	if err == nil {
+		var message string
+		message, err = runAction(opts, act, selected)
+		if err == nil && act.notify {
+			err = notify(message)
+		}
+	}
+	if err != nil {
+		printRofiMenu(opts, markupEscaper.Replace(err.Error()))
+	}
+}
+
+// notify shows message in a desktop notification, doing nothing if there is no way to show one.
+func notify(message string) error {
+	err := exec.Command(NotifyCommand, notifySummary, message).Run()
+	if errors.Is(err, exec.ErrNotFound) {
+		return nil
+	}
+	return err
+}
+
+func runRofiFieldPick(opts options, retv int, entry, key string) error {
+	if retv != rofiSelectedEntry {
+		return fmt.Errorf("Pick a field of %s", entry)
+	}
+	_, err := copyField(opts, entry, key)
+	return err
+}
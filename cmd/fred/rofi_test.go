@@ -0,0 +1,116 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// captureRofi runs fred as a rofi script mode call with the given return value and returns what it
+// lists for rofi.
+func captureRofi(t *testing.T, opts options, retv string) string {
+	t.Helper()
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = writer
+	defer func() {
+		os.Stdout = stdout
+	}()
+	runRofi(opts, retv)
+	writer.Close()
+	output, err := ioutil.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(output)
+}
+
+func rofiTestOptions(t *testing.T, args ...string) (options, string) {
+	t.Helper()
+	setupHome(t)
+	setupGnupg(t)
+	store := newTestStore(t, map[string]string{"web/site": "secret\nuser: me\npin: 1234\n"})
+	clipboard, clipboardFile := fakeClipboard(t, "previous", time.Second)
+	opts := testOptions(store, clipboard)
+	opts.args = args
+	t.Setenv(RofiInfoEnvVar, "")
+	t.Setenv(RofiDataEnvVar, "")
+	return opts, clipboardFile
+}
+
+func TestGetRofiKey(t *testing.T) {
+	for retv, expected := range map[int]int{
+		rofiSelectedEntry:      pickKey,
+		rofiFirstCustomKey:     1,
+		rofiFirstCustomKey + 2: 3,
+		rofiFirstCustomKey + 4: showFieldsKey,
+	} {
+		if key := getRofiKey(retv); key != expected {
+			t.Errorf("Expected key %d for %s=%d, got %d", expected, RofiRetvEnvVar, retv, key)
+		}
+	}
+}
+
+func TestRofiMenu(t *testing.T) {
+	opts, _ := rofiTestOptions(t)
+	output := captureRofi(t, opts, "0")
+	if !strings.Contains(output, "\x00message\x1f<b>Alt+1</b> copy username") {
+		t.Errorf("Expected the key help in the message, got %q", output)
+	}
+	if !strings.Contains(output, "web/site\x00info\x1fweb/site\x1ficon\x1f"+rofiIcon+"\n") {
+		t.Errorf("Expected the entry with its info, got %q", output)
+	}
+
+	output = captureRofi(t, opts, "x")
+	if !strings.Contains(output, "\x00message\x1fInvalid "+RofiRetvEnvVar+": x\n") {
+		t.Errorf("Expected an invalid return value in the message, got %q", output)
+	}
+}
+
+func TestRofiInfoOverridesArgument(t *testing.T) {
+	opts, clipboardFile := rofiTestOptions(t, "missing")
+	t.Setenv(RofiInfoEnvVar, "web/site")
+	output := captureRofi(t, opts, "10")
+	if output != "" {
+		t.Errorf("Expected rofi to close after the pick, got %q", output)
+	}
+	if content := readFile(t, clipboardFile); content != "me" {
+		t.Errorf("Expected the username of the entry in the info, got %q", content)
+	}
+	waitForFile(t, clipboardFile, "previous")
+
+	t.Setenv(RofiInfoEnvVar, "")
+	output = captureRofi(t, opts, "10")
+	if !strings.Contains(output, "\x00message\x1f") || !strings.Contains(output, "missing") {
+		t.Errorf("Expected the argument to be used without info, got %q", output)
+	}
+}
+
+func TestRofiFieldPick(t *testing.T) {
+	opts, clipboardFile := rofiTestOptions(t, "web/site")
+	output := captureRofi(t, opts, "14")
+	if !strings.Contains(output, "\x00data\x1fweb/site\n") || !strings.Contains(output, "pin\x00info\x1fpin") {
+		t.Fatalf("Expected the fields of the entry, got %q", output)
+	}
+
+	t.Setenv(RofiDataEnvVar, "web/site")
+	t.Setenv(RofiInfoEnvVar, "pin")
+	opts.args = []string{"pin"}
+	output = captureRofi(t, opts, "10")
+	if !strings.Contains(output, "Pick a field of web/site") {
+		t.Errorf("Expected a custom key on a field to bring the menu back, got %q", output)
+	}
+	output = captureRofi(t, opts, "1")
+	if output != "" {
+		t.Errorf("Expected rofi to close after picking a field, got %q", output)
+	}
+	if content := readFile(t, clipboardFile); content != "1234" {
+		t.Errorf("Expected the picked field in the clipboard, got %q", content)
+	}
+	waitForFile(t, clipboardFile, "previous")
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/femnad/mare"
+	"github.com/femnad/stuff/pkg/history"
+)
+
+const storePrefixSeparator = ":"
+
+// passwordStore is a pass store along with the history namespace its picks are recorded in. The
+// default store records to the root namespace, where the history of a single store always went,
+// any other store to the namespace of its name, so that rankings follow stores wherever they are
+// listed.
+type passwordStore struct {
+	name      string
+	path      string
+	namespace string
+}
+
+type selection struct {
+	store *passwordStore
+	entry string
+}
+
+// storeName names a store without a configured name after its directory, unless it is the default
+// store.
+func storeName(config storeConfig, path string) string {
+	if config.Name != "" {
+		return config.Name
+	}
+	if filepath.Clean(path) == filepath.Clean(mare.ExpandUser(PasswordStore)) {
+		return DefaultStoreName
+	}
+	return filepath.Base(path)
+}
+
+func storeNamespace(name string) string {
+	if name == DefaultStoreName {
+		return history.RootNamespace
+	}
+	return name
+}
+
+func newPasswordStores(configs []storeConfig) ([]*passwordStore, error) {
+	stores := make([]*passwordStore, 0, len(configs))
+	names := make(map[string]bool)
+	for _, storeConfig := range configs {
+		path := mare.ExpandUser(storeConfig.Path)
+		name := storeName(storeConfig, path)
+		if names[name] {
+			return nil, fmt.Errorf("Duplicate password store name %s", name)
+		}
+		if strings.Contains(name, storePrefixSeparator) {
+			return nil, fmt.Errorf("Password store name %s cannot contain %s", name, storePrefixSeparator)
+		}
+		names[name] = true
+		stores = append(stores, &passwordStore{
+			name:      name,
+			path:      path,
+			namespace: storeNamespace(name),
+		})
+	}
+	return stores, nil
+}
+
+func (s *passwordStore) gpgFile(entry string) string {
+	return filepath.Join(s.path, entry+GpgFileExtension)
+}
+
+// displayName prefixes entries with the store name only when there is more than one store, so a
+// single store looks the way it always did.
+func displayName(stores []*passwordStore, store *passwordStore, entry string) string {
+	if len(stores) == 1 {
+		return entry
+	}
+	return store.name + storePrefixSeparator + entry
+}
+
+func parseSelection(stores []*passwordStore, selected string) (selection, error) {
+	if len(stores) == 1 {
+		return selection{store: stores[0], entry: selected}, nil
+	}
+	separatorIndex := strings.Index(selected, storePrefixSeparator)
+	if separatorIndex >= 0 {
+		name := selected[:separatorIndex]
+		for _, store := range stores {
+			if store.name == name {
+				return selection{store: store, entry: selected[separatorIndex+1:]}, nil
+			}
+		}
+	}
+	return selection{}, fmt.Errorf("No password store for selection %s", selected)
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/femnad/stuff/pkg/history"
+)
+
+func TestGetStoreConfigs(t *testing.T) {
+	cfg := config{Stores: []storeConfig{{Name: "team", Path: "~/team-store"}}}
+	flagStores := storeFlags{{Path: "~/flag-store"}}
+
+	t.Setenv(PasswordStoreEnvVar, "")
+	if configs := getStoreConfigs(nil, config{}); !reflect.DeepEqual(configs, []storeConfig{{Path: PasswordStore}}) {
+		t.Errorf("Expected the default store, got %v", configs)
+	}
+	if configs := getStoreConfigs(nil, cfg); !reflect.DeepEqual(configs, cfg.Stores) {
+		t.Errorf("Expected the stores of the config file, got %v", configs)
+	}
+	t.Setenv(PasswordStoreEnvVar, "/env-store")
+	if configs := getStoreConfigs(nil, cfg); !reflect.DeepEqual(configs, []storeConfig{{Path: "/env-store"}}) {
+		t.Errorf("Expected the store of the environment, got %v", configs)
+	}
+	if configs := getStoreConfigs(flagStores, cfg); !reflect.DeepEqual(configs, []storeConfig(flagStores)) {
+		t.Errorf("Expected the stores of the command line, got %v", configs)
+	}
+}
+
+func TestStoreFlags(t *testing.T) {
+	var flagStores storeFlags
+	for _, value := range []string{"~/store", "team=~/team=store"} {
+		err := flagStores.Set(value)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	expected := storeFlags{{Path: "~/store"}, {Name: "team", Path: "~/team=store"}}
+	if !reflect.DeepEqual(flagStores, expected) {
+		t.Errorf("Expected %v, got %v", expected, flagStores)
+	}
+}
+
+func storeNamespaces(t *testing.T, configs []storeConfig) map[string]string {
+	t.Helper()
+	stores, err := newPasswordStores(configs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	namespaces := make(map[string]string)
+	for _, store := range stores {
+		namespaces[store.name] = store.namespace
+	}
+	return namespaces
+}
+
+func TestStoreNamespaces(t *testing.T) {
+	home := setupHome(t)
+	personal := storeConfig{Path: PasswordStore}
+	team := storeConfig{Path: "~/team-store"}
+
+	expected := map[string]string{DefaultStoreName: history.RootNamespace, "team-store": "team-store"}
+	for _, configs := range [][]storeConfig{{personal, team}, {team, personal}} {
+		if namespaces := storeNamespaces(t, configs); !reflect.DeepEqual(namespaces, expected) {
+			t.Errorf("Expected namespaces %v for stores %v, got %v", expected, configs, namespaces)
+		}
+	}
+	if namespaces := storeNamespaces(t, []storeConfig{team}); namespaces["team-store"] != "team-store" {
+		t.Errorf("Expected a single store other than the default one to keep its namespace, got %v", namespaces)
+	}
+	named := []storeConfig{{Name: "team", Path: filepath.Join(home, "team-store")}, {Name: "personal", Path: PasswordStore}}
+	expected = map[string]string{"team": "team", "personal": "personal"}
+	if namespaces := storeNamespaces(t, named); !reflect.DeepEqual(namespaces, expected) {
+		t.Errorf("Expected named stores to use their names, got %v", namespaces)
+	}
+}
+
+func TestNewPasswordStoresErrors(t *testing.T) {
+	setupHome(t)
+	for _, configs := range [][]storeConfig{
+		{{Path: "~/a/store"}, {Path: "~/b/store"}},
+		{{Name: "team", Path: "~/a"}, {Name: "team", Path: "~/b"}},
+		{{Path: PasswordStore}, {Name: DefaultStoreName, Path: "~/other"}},
+	} {
+		_, err := newPasswordStores(configs)
+		if err == nil || !strings.Contains(err.Error(), "Duplicate") {
+			t.Errorf("Expected a duplicate name error for %v, got %v", configs, err)
+		}
+	}
+	_, err := newPasswordStores([]storeConfig{{Name: "te:am", Path: "~/team"}})
+	if err == nil || !strings.Contains(err.Error(), storePrefixSeparator) {
+		t.Errorf("Expected an error for a name with a separator, got %v", err)
+	}
+}
+
+func TestParseSelection(t *testing.T) {
+	personal := &passwordStore{name: DefaultStoreName, path: "/personal"}
+	team := &passwordStore{name: "team", path: "/team"}
+	stores := []*passwordStore{personal, team}
+
+	for selected, expected := range map[string]selection{
+		"pass:web/site":    {store: personal, entry: "web/site"},
+		"team:vpn":         {store: team, entry: "vpn"},
+		"team:web:8080/ui": {store: team, entry: "web:8080/ui"},
+	} {
+		parsed, err := parseSelection(stores, selected)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if parsed != expected {
+			t.Errorf("Expected %v for %s, got %v", expected, selected, parsed)
+		}
+		if name := displayName(stores, parsed.store, parsed.entry); name != selected {
+			t.Errorf("Expected %s to be displayed as selected, got %s", selected, name)
+		}
+	}
+	for _, selected := range []string{"web/site", "other:web/site"} {
+		_, err := parseSelection(stores, selected)
+		if err == nil {
+			t.Errorf("Expected no store for %s", selected)
+		}
+	}
+
+	single := []*passwordStore{personal}
+	parsed, err := parseSelection(single, "team:vpn")
+	if err != nil || parsed != (selection{store: personal, entry: "team:vpn"}) {
+		t.Errorf("Expected a single store to take selections as they are, got %v, %v", parsed, err)
+	}
+	if name := displayName(single, personal, "team:vpn"); name != "team:vpn" {
+		t.Errorf("Expected a single store not to prefix entries, got %s", name)
+	}
+}
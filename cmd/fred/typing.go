@@ -0,0 +1,222 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	AutotypeField      = "autotype"
+	DefaultSequence    = "user :tab pass"
+	DefaultTypingDelay = 300 * time.Millisecond
+	SequenceDelay      = 500 * time.Millisecond
+	TypeFlag           = "type-after"
+
+	tabKey   = "Tab"
+	enterKey = "Return"
+	spaceKey = "space"
+)
+
+// typist types text it reads from its standard input and presses keys named as X keysyms.
+type typist struct {
+	typeArgs []string
+	keyArgs  func(key string) []string
+}
+
+// ydotool takes Linux input event codes instead of key names, each pressed and released.
+var ydotoolKeyCodes = map[string]int{
+	tabKey:   15,
+	enterKey: 28,
+	spaceKey: 57,
+}
+
+var typists = map[string]typist{
+	"xdotool": {
+		typeArgs: []string{"xdotool", "type", "--clearmodifiers", "--file", "-"},
+		keyArgs: func(key string) []string {
+			return []string{"xdotool", "key", "--clearmodifiers", key}
+		},
+	},
+	"ydotool": {
+		typeArgs: []string{"ydotool", "type", "--file", "-"},
+		keyArgs: func(key string) []string {
+			code := ydotoolKeyCodes[key]
+			return []string{"ydotool", "key", fmt.Sprintf("%d:1", code), fmt.Sprintf("%d:0", code)}
+		},
+	},
+	"wtype": {
+		typeArgs: []string{"wtype", "-"},
+		keyArgs: func(key string) []string {
+			return []string{"wtype", "-k", key}
+		},
+	},
+}
+
+// typingConfig picks the typing tool, xdotool on X11 and wtype on Wayland unless set, or the
+// commands for typing text and pressing keys, the key name being added to the latter. Delay is how
+// long to wait for the menu to go away before typing.
+type typingConfig struct {
+	Tool     string        `yaml:"tool"`
+	Type     []string      `yaml:"type"`
+	Key      []string      `yaml:"key"`
+	Delay    time.Duration `yaml:"delay"`
+	Sequence string        `yaml:"sequence"`
+}
+
+// typeStep is one step of typing a sequence: typing text, pressing a key or waiting.
+type typeStep struct {
+	Text  string        `json:"text,omitempty"`
+	Key   string        `json:"key,omitempty"`
+	Delay time.Duration `json:"delay,omitempty"`
+}
+
+type typeRequest struct {
+	Typing typingConfig `json:"typing"`
+	Steps  []typeStep   `json:"steps"`
+}
+
+func typistNames() []string {
+	names := make([]string, 0, len(typists))
+	for name := range typists {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (c typingConfig) withDefaults() typingConfig {
+	if c.Tool == "" {
+		c.Tool = "xdotool"
+		if isWayland() {
+			c.Tool = "wtype"
+		}
+	}
+	if c.Delay == 0 {
+		c.Delay = DefaultTypingDelay
+	}
+	if c.Sequence == "" {
+		c.Sequence = DefaultSequence
+	}
+	return c
+}
+
+func (c typingConfig) getTypist() (typist, error) {
+	chosen, ok := typists[c.Tool]
+	if !ok && (len(c.Type) == 0 || len(c.Key) == 0) {
+		return typist{}, fmt.Errorf("Unknown typing tool %s, known tools are %s", c.Tool,
+			strings.Join(typistNames(), ", "))
+	}
+	if len(c.Type) > 0 {
+		chosen.typeArgs = c.Type
+	}
+	if len(c.Key) > 0 {
+		chosen.keyArgs = func(key string) []string {
+			return append(append([]string{}, c.Key...), key)
+		}
+	}
+	return chosen, nil
+}
+
+func runTypingCommand(args []string, stdin string) error {
+	command := exec.Command(args[0], args[1:]...)
+	command.Stdin = strings.NewReader(stdin)
+	output, err := command.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("Error typing with %s: %w: %s", args[0], err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+func (t typist) run(steps []typeStep) error {
+	for _, step := range steps {
+		var err error
+		switch {
+		case step.Delay > 0:
+			time.Sleep(step.Delay)
+		case step.Key != "":
+			err = runTypingCommand(t.keyArgs(step.Key), "")
+		default:
+			err = runTypingCommand(t.typeArgs, step.Text)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseSequence turns a sequence such as `user :tab pass :enter` into the steps to type it. Words
+// starting with a colon are keys or `:delay`, `pass` is the password, `:otp` is the current TOTP
+// code, and any other word is the value of the field of the entry with that name.
+func parseSequence(sequence string, name string, entry passEntry) ([]typeStep, error) {
+	steps := make([]typeStep, 0)
+	for _, word := range strings.Fields(sequence) {
+		switch word {
+		case ":tab":
+			steps = append(steps, typeStep{Key: tabKey})
+		case ":enter":
+			steps = append(steps, typeStep{Key: enterKey})
+		case ":space":
+			steps = append(steps, typeStep{Key: spaceKey})
+		case ":delay":
+			steps = append(steps, typeStep{Delay: SequenceDelay})
+		case ":otp":
+			code, _, err := entryOTP(name, entry)
+			if err != nil {
+				return nil, err
+			}
+			steps = append(steps, typeStep{Text: code})
+		case "pass", PasswordField:
+			steps = append(steps, typeStep{Text: entry.password})
+		case "user":
+			steps = append(steps, typeStep{Text: entry.username(name)})
+		default:
+			if strings.HasPrefix(word, ":") {
+				return nil, fmt.Errorf("Unknown key %s in sequence %s", word, sequence)
+			}
+			value, ok := entry.field(word)
+			if !ok {
+				return nil, fmt.Errorf("No field %s in %s for sequence %s", word, name, sequence)
+			}
+			steps = append(steps, typeStep{Text: value})
+		}
+	}
+	return steps, nil
+}
+
+// entrySequence is the sequence in the autotype field of the entry if it has one.
+func entrySequence(cfg typingConfig, entry passEntry) string {
+	sequence, ok := entry.field(AutotypeField)
+	if ok && sequence != "" {
+		return sequence
+	}
+	return cfg.Sequence
+}
+
+// scheduleTyping types from a copy of fred that outlives it, as the menu fred runs under keeps the
+// focus until fred exits.
+func scheduleTyping(cfg typingConfig, steps []typeStep) error {
+	_, err := cfg.getTypist()
+	if err != nil {
+		return err
+	}
+	args := []string{fmt.Sprintf("-%s=%s", TypeFlag, cfg.Delay)}
+	return startDetached(args, typeRequest{Typing: cfg, Steps: steps})
+}
+
+func typeAfter(after time.Duration) error {
+	var request typeRequest
+	err := readDetachedRequest(&request)
+	if err != nil {
+		return err
+	}
+	chosen, err := request.Typing.getTypist()
+	if err != nil {
+		return err
+	}
+	time.Sleep(after)
+	return chosen.run(request.Steps)
+}
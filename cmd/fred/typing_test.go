@@ -0,0 +1,115 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"testing"
+	"time"
+)
+
+const testEntry = "secret\nuser: me\npin: 1234\notpauth://totp/Example:me?secret=JBSWY3DPEHPK3PXP\n"
+
+// fakeTyping records what is typed to a file, with the keys pressed in angle brackets.
+func fakeTyping(t *testing.T) (typingConfig, string) {
+	t.Helper()
+	typedFile := filepath.Join(t.TempDir(), "typed")
+	cfg := typingConfig{
+		Type:  []string{"sh", "-c", "cat >> " + typedFile},
+		Key:   []string{"sh", "-c", "printf '<%s>' \"$0\" >> " + typedFile},
+		Delay: 10 * time.Millisecond,
+	}
+	return cfg.withDefaults(), typedFile
+}
+
+func TestParseSequence(t *testing.T) {
+	entry := parseEntry(testEntry)
+	steps, err := parseSequence("user :tab pass :space pin :delay :enter", "web/site", entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []typeStep{
+		{Text: "me"},
+		{Key: tabKey},
+		{Text: "secret"},
+		{Key: spaceKey},
+		{Text: "1234"},
+		{Delay: SequenceDelay},
+		{Key: enterKey},
+	}
+	if !reflect.DeepEqual(steps, expected) {
+		t.Errorf("Expected steps %v, got %v", expected, steps)
+	}
+}
+
+func TestParseSequenceOTP(t *testing.T) {
+	steps, err := parseSequence(":otp", "web/site", parseEntry(testEntry))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(steps) != 1 || !regexp.MustCompile(`^[0-9]{6}$`).MatchString(steps[0].Text) {
+		t.Errorf("Expected a step typing a code, got %v", steps)
+	}
+}
+
+func TestParseSequenceErrors(t *testing.T) {
+	for _, sequence := range []string{"user :escape", "user email", ":otp"} {
+		_, err := parseSequence(sequence, "web/site", parseEntry("secret\nuser: me\n"))
+		if err == nil {
+			t.Errorf("Expected an error parsing %s", sequence)
+		}
+	}
+}
+
+func TestEntrySequence(t *testing.T) {
+	cfg := typingConfig{}.withDefaults()
+	if sequence := entrySequence(cfg, parseEntry(testEntry)); sequence != DefaultSequence {
+		t.Errorf("Expected the default sequence, got %s", sequence)
+	}
+	entry := parseEntry("secret\nautotype: pin :enter\n")
+	if sequence := entrySequence(cfg, entry); sequence != "pin :enter" {
+		t.Errorf("Expected the sequence of the entry, got %s", sequence)
+	}
+	cfg.Sequence = "pass :enter"
+	if sequence := entrySequence(cfg, parseEntry(testEntry)); sequence != "pass :enter" {
+		t.Errorf("Expected the configured sequence, got %s", sequence)
+	}
+}
+
+func TestTypistRun(t *testing.T) {
+	cfg, typedFile := fakeTyping(t)
+	chosen, err := cfg.getTypist()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = chosen.run([]typeStep{{Text: "me"}, {Key: tabKey}, {Text: "secret"}, {Key: enterKey}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if typed := readFile(t, typedFile); typed != "me<Tab>secret<Return>" {
+		t.Errorf("Unexpected typing %q", typed)
+	}
+}
+
+func TestUnknownTypist(t *testing.T) {
+	_, err := typingConfig{Tool: "typewriter"}.getTypist()
+	if err == nil {
+		t.Error("Expected an error for an unknown typing tool")
+	}
+}
+
+func TestAutotype(t *testing.T) {
+	setupHome(t)
+	setupGnupg(t)
+	store := newTestStore(t, map[string]string{"web/site": "secret\nuser: me\nautotype: user :tab pass :enter\n"})
+	clipboard, _ := fakeClipboard(t, "", time.Second)
+	cfg, typedFile := fakeTyping(t)
+	opts := testOptions(store, clipboard)
+	opts.typing = cfg
+
+	_, err := runAction(opts, action{run: autotype}, "web/site")
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitForFile(t, typedFile, "me<Tab>secret<Return>")
+}
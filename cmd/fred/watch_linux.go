@@ -0,0 +1,135 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+const (
+	watchMask = syscall.IN_CREATE | syscall.IN_DELETE | syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO |
+		syscall.IN_DELETE_SELF | syscall.IN_MOVE_SELF | syscall.IN_ONLYDIR
+	// Changes usually come in bursts, such as a git pull, so the index is refreshed once they settle.
+	watchSettleTime  = 200 * time.Millisecond
+	inotifyEventSize = syscall.SizeofInotifyEvent + syscall.NAME_MAX + 1
+)
+
+// lockWatch takes the lock that tells fred a watcher keeps the index of a store fresh.
+func lockWatch(storePath string) (*os.File, error) {
+	lockPath := getIndexPath(storePath) + watchLockSuffix
+	err := os.MkdirAll(filepath.Dir(lockPath), indexDirMode)
+	if err != nil {
+		return nil, err
+	}
+	lockFile, err := os.OpenFile(lockPath, os.O_RDWR|os.O_CREATE, indexFileMode)
+	if err != nil {
+		return nil, err
+	}
+	err = syscall.Flock(int(lockFile.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if err == syscall.EWOULDBLOCK {
+		lockFile.Close()
+		return nil, fmt.Errorf("%s is already being watched", storePath)
+	} else if err != nil {
+		lockFile.Close()
+		return nil, err
+	}
+	return lockFile, nil
+}
+
+// refreshAndWatch refreshes the index of a store and watches all of its directories. Watching a
+// directory again is harmless, so directories are not tracked between refreshes.
+func refreshAndWatch(fd int, storePath string) error {
+	index, _, err := refreshIndex(storePath, true)
+	if err != nil {
+		return err
+	}
+	for relPath := range index.Dirs {
+		_, err = syscall.InotifyAddWatch(fd, filepath.Join(storePath, relPath), watchMask)
+		if err != nil && err != syscall.ENOENT {
+			return err
+		}
+	}
+	return nil
+}
+
+func readInotifyEvents(fd int, events chan<- error) {
+	buffer := make([]byte, inotifyEventSize*64)
+	for {
+		n, err := syscall.Read(fd, buffer)
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != nil {
+			events <- err
+			return
+		}
+		for offset := 0; offset+syscall.SizeofInotifyEvent <= n; {
+			event := (*syscall.InotifyEvent)(unsafe.Pointer(&buffer[offset]))
+			offset += syscall.SizeofInotifyEvent + int(event.Len)
+			if event.Mask&syscall.IN_Q_OVERFLOW != 0 || event.Mask&watchMask != 0 {
+				events <- nil
+			}
+		}
+	}
+}
+
+// watchStores keeps the indexes of the stores fresh until it fails. As inotify only sees changes
+// made through this machine, not ones made by other clients of a network file system, the stores
+// are also checked periodically.
+func watchStores(stores []*passwordStore) error {
+	for _, store := range stores {
+		lockFile, err := lockWatch(store.path)
+		if err != nil {
+			return err
+		}
+		defer lockFile.Close()
+	}
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC)
+	if err != nil {
+		return err
+	}
+	defer syscall.Close(fd)
+
+	refreshAll := func() error {
+		for _, store := range stores {
+			err := refreshAndWatch(fd, store.path)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	err = refreshAll()
+	if err != nil {
+		return err
+	}
+
+	events := make(chan error)
+	go readInotifyEvents(fd, events)
+	checks := time.NewTicker(watchedIndexMaxAge / 2)
+	defer checks.Stop()
+	var settled <-chan time.Time
+	for {
+		select {
+		case err = <-events:
+			if err != nil {
+				return err
+			}
+			settled = time.After(watchSettleTime)
+		case <-settled:
+			settled = nil
+			err = refreshAll()
+		case <-checks.C:
+			err = refreshAll()
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+import "fmt"
+
+func watchStores(stores []*passwordStore) error {
+	return fmt.Errorf("Watching stores needs inotify, which is only available on Linux")
+}
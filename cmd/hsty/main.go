@@ -0,0 +1,355 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/alexflint/go-arg"
+	"github.com/femnad/mare"
+	"github.com/femnad/stuff/pkg/history"
+)
+
+const (
+	defaultBackend = history.FileBackendKind
+	defaultFile    = "~/.config/fred/fred_history"
+	timeFormat     = "2006-01-02 15:04"
+)
+
+type listCmd struct {
+	Limit   int    `arg:"-n" help:"number of items to list, all if zero"`
+	Ranking string `arg:"-r" help:"comma separated rankers from count, recency, frecency[:half-life] and alpha, frecency,count,alpha if omitted"`
+}
+
+type queryCmd struct {
+	Search     string `arg:"positional,required"`
+	Candidates string `arg:"-c" help:"file with one candidate per line, - for standard input, history items if omitted"`
+	Limit      int    `arg:"-n" help:"number of matches to list, all if zero"`
+}
+
+type bumpCmd struct {
+	Items []string `arg:"positional,required"`
+}
+
+type forgetCmd struct {
+	Items []string `arg:"positional,required"`
+}
+
+type setCmd struct {
+	Item  string `arg:"positional,required"`
+	Count int    `arg:"positional,required"`
+}
+
+type importCmd struct {
+	File       string        `arg:"positional,required"`
+	Replace    bool          `help:"replace the history instead of merging into it"`
+	HalveEvery time.Duration `arg:"--halve-every" help:"period the histories are compacted with, so that merging keeps counts halved"`
+}
+
+type exportCmd struct {
+	File string `arg:"positional" help:"file to export to, standard output if omitted"`
+}
+
+type compactCmd struct {
+	MaxEntries int           `arg:"--max-entries" help:"keep only this many entries"`
+	MaxAge     time.Duration `arg:"--max-age" help:"drop entries unused for longer than this"`
+	MinCount   int           `arg:"--min-count" help:"drop entries used fewer times than this"`
+	HalveEvery time.Duration `arg:"--halve-every" help:"halve counts once per this period"`
+}
+
+type eventsCmd struct{}
+
+type encryptCmd struct{}
+
+type decryptCmd struct{}
+
+var args struct {
+	Backend        string      `arg:"-b" help:"history backend: file, journal or bolt"`
+	File           string      `arg:"-f" help:"history file"`
+	Namespace      string      `arg:"-N" help:"history namespace"`
+	KeyFile        string      `arg:"--key-file" help:"key file for an encrypted history"`
+	PassphraseFile string      `arg:"--passphrase-file" help:"file holding the passphrase for an encrypted history"`
+	List           *listCmd    `arg:"subcommand:list" help:"list items in ranked order"`
+	Query          *queryCmd   `arg:"subcommand:query" help:"list items matching a search, best and most used first"`
+	Bump           *bumpCmd    `arg:"subcommand:bump" help:"record a use of items"`
+	Forget         *forgetCmd  `arg:"subcommand:forget" help:"remove items"`
+	Set            *setCmd     `arg:"subcommand:set" help:"set the count of an item"`
+	Import         *importCmd  `arg:"subcommand:import" help:"merge a history file into the history"`
+	Export         *exportCmd  `arg:"subcommand:export" help:"write the history in the current format"`
+	Compact        *compactCmd `arg:"subcommand:compact" help:"apply a retention policy"`
+	Events         *eventsCmd  `arg:"subcommand:events" help:"list the changes in the journal of a journal backend"`
+	Encrypt        *encryptCmd `arg:"subcommand:encrypt" help:"encrypt a plaintext history file in place"`
+	Decrypt        *decryptCmd `arg:"subcommand:decrypt" help:"decrypt an encrypted history file in place"`
+}
+
+func openBackend() (history.Backend, error) {
+	cipher, err := history.OpenCipher(args.KeyFile, args.PassphraseFile)
+	if err != nil {
+		return nil, err
+	}
+	return history.OpenBackend(args.Backend, mare.ExpandUser(args.File), cipher)
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Format(timeFormat)
+}
+
+func list(backend history.Backend, cmd *listCmd) error {
+	historyMap, err := backend.Load()
+	if err != nil {
+		return err
+	}
+	ranking := cmd.Ranking
+	if ranking == "" {
+		ranking = history.DefaultRanking
+	}
+	ranker, err := history.ParseRanking(ranking, time.Now())
+	if err != nil {
+		return err
+	}
+	var items []string
+	if cmd.Limit > 0 {
+		items = history.RankTop(historyMap, ranker, cmd.Limit)
+	} else {
+		items = history.Rank(historyMap, ranker)
+	}
+	writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	for _, item := range items {
+		entry := historyMap[item]
+		fmt.Fprintf(writer, "%d\t%s\t%s\n", entry.Count, formatTime(entry.LastUsed), item)
+	}
+	return writer.Flush()
+}
+
+func readCandidates(path string) ([]string, error) {
+	reader := os.Stdin
+	if path != "-" {
+		file, err := os.Open(mare.ExpandUser(path))
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		reader = file
+	}
+	candidates := make([]string, 0)
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		if scanner.Text() != "" {
+			candidates = append(candidates, scanner.Text())
+		}
+	}
+	return candidates, scanner.Err()
+}
+
+func query(backend history.Backend, cmd *queryCmd) error {
+	historyMap, err := backend.Load()
+	if err != nil {
+		return err
+	}
+	var candidates []string
+	if cmd.Candidates == "" {
+		candidates = history.GetOrderedHistoryByCount(historyMap)
+	} else {
+		candidates, err = readCandidates(cmd.Candidates)
+		if err != nil {
+			return err
+		}
+	}
+	usage := history.FrecencyScorer(time.Now(), history.DefaultHalfLife)
+	matches := history.Query(candidates, cmd.Search, historyMap, usage)
+	if cmd.Limit > 0 && len(matches) > cmd.Limit {
+		matches = matches[:cmd.Limit]
+	}
+	for _, match := range matches {
+		fmt.Println(match.Item)
+	}
+	return nil
+}
+
+func bump(backend history.Backend, cmd *bumpCmd) error {
+	now := time.Now()
+	for _, item := range cmd.Items {
+		err := backend.Record(item, now)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func forget(backend history.Backend, cmd *forgetCmd) error {
+	for _, item := range cmd.Items {
+		err := backend.Forget(item)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// set attributes the whole new count to the local device. Merging with copies of the history from
+// other devices brings their counts back. The entry is changed in a single update, so uses recorded
+// meanwhile are not lost.
+func set(backend *history.Namespaced, cmd *setCmd) error {
+	if cmd.Count < 0 {
+		return fmt.Errorf("Count cannot be negative: %d", cmd.Count)
+	}
+	return backend.Update(func(historyMap history.History) error {
+		entry := historyMap[cmd.Item]
+		entry.Count = cmd.Count
+		entry.Devices = map[string]int{history.LocalDevice(): cmd.Count}
+		if len(entry.Recent) > cmd.Count {
+			entry.Recent = entry.Recent[len(entry.Recent)-cmd.Count:]
+		}
+		historyMap[cmd.Item] = entry
+		return nil
+	})
+}
+
+func importHistory(backend history.Backend, cmd *importCmd) error {
+	file, err := os.Open(mare.ExpandUser(cmd.File))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	imported, err := history.Load(file)
+	if err != nil {
+		return err
+	}
+	if cmd.Replace {
+		return backend.Replace(imported)
+	}
+	return history.MergeIntoHalving(backend, cmd.HalveEvery, imported)
+}
+
+func export(backend history.Backend, cmd *exportCmd) error {
+	historyMap, err := backend.Load()
+	if err != nil {
+		return err
+	}
+	var writer io.Writer = os.Stdout
+	if cmd.File != "" {
+		file, err := os.OpenFile(mare.ExpandUser(cmd.File), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		writer = file
+	}
+	return history.Save(writer, historyMap)
+}
+
+func compact(backend history.Backend, cmd *compactCmd) error {
+	policy := history.RetentionPolicy{
+		MaxEntries: cmd.MaxEntries,
+		MaxAge:     cmd.MaxAge,
+		MinCount:   cmd.MinCount,
+		HalveEvery: cmd.HalveEvery,
+	}
+	dropped, err := history.Compact(backend, policy, time.Now())
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Dropped %d entries\n", dropped)
+	return nil
+}
+
+func events() error {
+	backend, err := openBackend()
+	if err != nil {
+		return err
+	}
+	defer backend.Close()
+	journal, ok := backend.(*history.Journal)
+	if !ok {
+		return fmt.Errorf("Only the %s backend keeps events", history.JournalBackendKind)
+	}
+	journalEvents, err := journal.Events()
+	if err != nil {
+		return err
+	}
+	writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	for _, event := range journalEvents {
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\n", formatTime(event.When), event.Device, event.Op, event.Item)
+	}
+	return writer.Flush()
+}
+
+// convert rewrites the whole history, unencrypted if decrypt is set and encrypted otherwise.
+// Encrypted backends read plaintext histories as is, so both directions load through one.
+func convert(decrypt bool) error {
+	cipher, err := history.OpenCipher(args.KeyFile, args.PassphraseFile)
+	if err != nil {
+		return err
+	}
+	if cipher == nil {
+		return fmt.Errorf("A key file or a passphrase file is needed")
+	}
+	path := mare.ExpandUser(args.File)
+	backend, err := history.OpenBackend(args.Backend, path, cipher)
+	if err != nil {
+		return err
+	}
+	defer backend.Close()
+	if decrypt {
+		cipher = nil
+	}
+	return history.Rekey(backend, cipher)
+}
+
+func run(parser *arg.Parser) error {
+	switch {
+	case args.Events != nil:
+		return events()
+	case args.Encrypt != nil:
+		return convert(false)
+	case args.Decrypt != nil:
+		return convert(true)
+	}
+
+	opened, err := openBackend()
+	if err != nil {
+		return err
+	}
+	backend := history.Namespace(opened, args.Namespace)
+	defer backend.Close()
+
+	switch {
+	case args.List != nil:
+		return list(backend, args.List)
+	case args.Query != nil:
+		return query(backend, args.Query)
+	case args.Bump != nil:
+		return bump(backend, args.Bump)
+	case args.Forget != nil:
+		return forget(backend, args.Forget)
+	case args.Set != nil:
+		return set(backend, args.Set)
+	case args.Import != nil:
+		return importHistory(backend, args.Import)
+	case args.Export != nil:
+		return export(backend, args.Export)
+	case args.Compact != nil:
+		return compact(backend, args.Compact)
+	default:
+		parser.WriteHelp(os.Stdout)
+		return nil
+	}
+}
+
+func main() {
+	args.Backend = defaultBackend
+	args.File = defaultFile
+	parser := arg.MustParse(&args)
+	err := run(parser)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
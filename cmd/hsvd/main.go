@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/alexflint/go-arg"
+	"github.com/femnad/mare"
+	"github.com/femnad/stuff/pkg/history"
+)
+
+const (
+	defaultBackend = history.FileBackendKind
+	defaultFile    = "~/.config/fred/fred_history"
+)
+
+var args struct {
+	Backend string `arg:"-b" help:"history backend: file, journal or bolt"`
+	File    string `arg:"-f" help:"history file"`
+	KeyFile string `arg:"--key-file" help:"key file for an encrypted history"`
+	Socket  string `arg:"-s" help:"socket to listen on"`
+}
+
+func getCipher() (*history.Cipher, error) {
+	if args.KeyFile == "" {
+		return nil, nil
+	}
+	return history.NewKeyFileCipher(mare.ExpandUser(args.KeyFile))
+}
+
+func closeOnSignal(closeFn func()) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-signals
+		closeFn()
+	}()
+}
+
+func serve() error {
+	cipher, err := getCipher()
+	if err != nil {
+		return err
+	}
+	backend, err := history.OpenBackend(args.Backend, mare.ExpandUser(args.File), cipher)
+	if err != nil {
+		return err
+	}
+	defer backend.Close()
+
+	listener, err := history.Listen(args.Socket)
+	if err != nil {
+		return err
+	}
+	stopped := make(chan struct{})
+	closeOnSignal(func() {
+		close(stopped)
+		listener.Close()
+	})
+
+	err = history.NewServer(backend).Serve(listener)
+	select {
+	case <-stopped:
+		return nil
+	default:
+		return err
+	}
+}
+
+func main() {
+	args.Backend = defaultBackend
+	args.File = defaultFile
+	args.Socket = history.DefaultSocketPath()
+	arg.MustParse(&args)
+	err := serve()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
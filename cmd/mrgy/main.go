@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/alexflint/go-arg"
+	"github.com/femnad/mare"
+	"github.com/femnad/stuff/pkg/history"
+)
+
+const (
+	defaultBackend = history.FileBackendKind
+	defaultTarget  = "~/.config/fred/fred_history"
+)
+
+var args struct {
+	Backend        string        `arg:"-b" help:"history backend of the sources and the target: file, journal or bolt"`
+	Into           string        `arg:"-i" help:"history file to merge into"`
+	KeyFile        string        `arg:"--key-file" help:"key file for encrypted histories"`
+	PassphraseFile string        `arg:"--passphrase-file" help:"file holding the passphrase for encrypted histories"`
+	HalveEvery     time.Duration `arg:"--halve-every" help:"period the histories are compacted with, so that merging keeps counts halved"`
+	Sources        []string      `arg:"positional,required" help:"history files to merge"`
+}
+
+// checkSource fails for a source that does not exist, as backends take a missing history for an
+// empty one, which would hide a mistyped source.
+func checkSource(path string) error {
+	_, err := os.Stat(path)
+	if os.IsNotExist(err) && args.Backend == history.JournalBackendKind {
+		// A journal that has never been folded has no snapshot yet.
+		_, err = os.Stat(history.JournalPath(path))
+	}
+	return err
+}
+
+// loadSource loads the history at path, with the uses that are not attributed to any device
+// attributed to the source itself. The source is named by its absolute path so that merging it
+// again does not count its uses twice.
+func loadSource(path string, cipher *history.Cipher) (history.History, error) {
+	err := checkSource(path)
+	if err != nil {
+		return nil, err
+	}
+	device, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	backend, err := history.OpenBackend(args.Backend, path, cipher)
+	if err != nil {
+		return nil, err
+	}
+	defer backend.Close()
+	sourceHistory, err := backend.Load()
+	if err != nil {
+		return nil, err
+	}
+	return history.Attribute(sourceHistory, device), nil
+}
+
+// mergeHistories merges the sources into target. Encrypted histories all have to be encrypted with
+// the given key, plaintext ones are read as they are, and target is written encrypted when a key is
+// given.
+func mergeHistories(target string, sources []string) error {
+	cipher, err := history.OpenCipher(args.KeyFile, args.PassphraseFile)
+	if err != nil {
+		return err
+	}
+	histories := make([]history.History, 0, len(sources))
+	for _, source := range sources {
+		sourceHistory, err := loadSource(mare.ExpandUser(source), cipher)
+		if err != nil {
+			return fmt.Errorf("Error loading history %s: %w", source, err)
+		}
+		histories = append(histories, sourceHistory)
+	}
+	targetBackend, err := history.OpenBackend(args.Backend, mare.ExpandUser(target), cipher)
+	if err != nil {
+		return fmt.Errorf("Error opening history %s: %w", target, err)
+	}
+	defer targetBackend.Close()
+	err = history.MergeIntoHalving(targetBackend, args.HalveEvery, histories...)
+	if err != nil {
+		return fmt.Errorf("Error merging into %s: %w", target, err)
+	}
+	return nil
+}
+
+func main() {
+	args.Backend = defaultBackend
+	args.Into = defaultTarget
+	arg.MustParse(&args)
+	err := mergeHistories(args.Into, args.Sources)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,105 @@
+package history
+
+import (
+	"fmt"
+	"time"
+)
+
+// Backend persists a History. Implementations apply changes to single items without rewriting
+// unrelated items where the underlying storage allows it.
+type Backend interface {
+	Load() (History, error)
+	Record(item string, when time.Time) error
+	Put(item string, entry Entry) error
+	Forget(item string) error
+	Replace(history History) error
+	Close() error
+}
+
+type updater interface {
+	Update(fn func(History) error) error
+}
+
+// update runs a read-modify-write cycle on backend, under the backend's lock if it has one.
+func update(backend Backend, fn func(History) error) error {
+	u, ok := backend.(updater)
+	if ok {
+		return u.Update(fn)
+	}
+	history, err := backend.Load()
+	if err != nil {
+		return err
+	}
+	err = fn(history)
+	if err != nil {
+		return err
+	}
+	return backend.Replace(history)
+}
+
+type rekeyer interface {
+	Rekey(c *Cipher) error
+}
+
+// Rekey rewrites the history of backend encrypted with c, or unencrypted if c is nil. The history
+// is read with the cipher backend was opened with.
+func Rekey(backend Backend, c *Cipher) error {
+	r, ok := backend.(rekeyer)
+	if !ok {
+		return fmt.Errorf("History backend cannot be encrypted")
+	}
+	return r.Rekey(c)
+}
+
+func copyEntry(entry Entry) Entry {
+	entry.Recent = append([]time.Time(nil), entry.Recent...)
+	if entry.Devices != nil {
+		devices := make(map[string]int, len(entry.Devices))
+		for device, count := range entry.Devices {
+			devices[device] = count
+		}
+		entry.Devices = devices
+	}
+	return entry
+}
+
+func copyHistory(history History) History {
+	copied := make(History, len(history))
+	for item, entry := range history {
+		copied[item] = copyEntry(entry)
+	}
+	return copied
+}
+
+var (
+	_ Backend = (*Store)(nil)
+	_ Backend = (*MemoryBackend)(nil)
+	_ Backend = (*BoltBackend)(nil)
+	_ Backend = (*Namespaced)(nil)
+	_ Backend = (*Journal)(nil)
+	_ Backend = (*Client)(nil)
+)
+
+const (
+	FileBackendKind    = "file"
+	BoltBackendKind    = "bolt"
+	JournalBackendKind = "journal"
+)
+
+// OpenBackend opens a backend of the given kind at path. The history is encrypted with c when it
+// is not nil, which only file based backends support.
+func OpenBackend(kind, path string, c *Cipher) (Backend, error) {
+	switch kind {
+	case FileBackendKind:
+		return NewEncryptedStore(path, c), nil
+	case JournalBackendKind:
+		return NewJournal(NewEncryptedStore(path, c)), nil
+	case BoltBackendKind:
+		if c != nil {
+			return nil, fmt.Errorf("The %s history backend cannot be encrypted", kind)
+		}
+		return OpenBoltBackend(path)
+	default:
+		return nil, fmt.Errorf("Unknown history backend %s", kind)
+	}
+}
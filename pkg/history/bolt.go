@@ -0,0 +1,181 @@
+package history
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var historyBucket = []byte("history")
+
+// BoltBackend keeps a History in an embedded key-value database, one key per item, so recording a
+// use only touches the item that was used.
+type BoltBackend struct {
+	db *bolt.DB
+}
+
+func OpenBoltBackend(path string) (*BoltBackend, error) {
+	err := os.MkdirAll(filepath.Dir(path), storeDirMode)
+	if err != nil {
+		return nil, err
+	}
+	db, err := bolt.Open(path, storeFileMode, &bolt.Options{Timeout: time.Minute})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(historyBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &BoltBackend{db: db}, nil
+}
+
+func getBoltEntry(bucket *bolt.Bucket, item string) (Entry, error) {
+	value := bucket.Get([]byte(item))
+	if value == nil {
+		return Entry{}, nil
+	}
+	return decodeBoltEntry(value)
+}
+
+func decodeBoltEntry(value []byte) (Entry, error) {
+	var r record
+	err := json.Unmarshal(value, &r)
+	if err != nil {
+		return Entry{}, err
+	}
+	return r.entry(), nil
+}
+
+func putBoltEntry(bucket *bolt.Bucket, item string, entry Entry) error {
+	value, err := json.Marshal(toRecord("", entry))
+	if err != nil {
+		return err
+	}
+	return bucket.Put([]byte(item), value)
+}
+
+func readBoltHistory(bucket *bolt.Bucket) (History, error) {
+	history := make(History)
+	err := bucket.ForEach(func(key, value []byte) error {
+		entry, err := decodeBoltEntry(value)
+		if err != nil {
+			return fmt.Errorf("Error decoding history item %q: %w", key, err)
+		}
+		history[string(key)] = entry
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return history, nil
+}
+
+// writeBoltHistory makes the bucket hold history, only touching the items that changed.
+func writeBoltHistory(bucket *bolt.Bucket, history History) error {
+	var removed [][]byte
+	err := bucket.ForEach(func(key, value []byte) error {
+		_, ok := history[string(key)]
+		if !ok {
+			removed = append(removed, append([]byte(nil), key...))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, key := range removed {
+		err = bucket.Delete(key)
+		if err != nil {
+			return err
+		}
+	}
+	for item, entry := range history {
+		value, err := json.Marshal(toRecord("", entry))
+		if err != nil {
+			return err
+		}
+		if bytes.Equal(bucket.Get([]byte(item)), value) {
+			continue
+		}
+		err = bucket.Put([]byte(item), value)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *BoltBackend) Load() (History, error) {
+	var history History
+	err := b.db.View(func(tx *bolt.Tx) error {
+		var err error
+		history, err = readBoltHistory(tx.Bucket(historyBucket))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return history, nil
+}
+
+// Update lets fn modify the history and writes back what changed, all in a single transaction.
+// Nothing is written if fn returns an error.
+func (b *BoltBackend) Update(fn func(History) error) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(historyBucket)
+		history, err := readBoltHistory(bucket)
+		if err != nil {
+			return err
+		}
+		err = fn(history)
+		if err != nil {
+			return err
+		}
+		return writeBoltHistory(bucket, history)
+	})
+}
+
+func (b *BoltBackend) Record(item string, when time.Time) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(historyBucket)
+		entry, err := getBoltEntry(bucket, item)
+		if err != nil {
+			return err
+		}
+		single := History{item: entry}
+		AddToHistoryAt(single, item, when)
+		return putBoltEntry(bucket, item, single[item])
+	})
+}
+
+func (b *BoltBackend) Put(item string, entry Entry) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return putBoltEntry(tx.Bucket(historyBucket), item, entry)
+	})
+}
+
+func (b *BoltBackend) Forget(item string) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(historyBucket).Delete([]byte(item))
+	})
+}
+
+func (b *BoltBackend) Replace(history History) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return writeBoltHistory(tx.Bucket(historyBucket), history)
+	})
+}
+
+func (b *BoltBackend) Close() error {
+	return b.db.Close()
+}
@@ -0,0 +1,81 @@
+package history
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func openTestBolt(t *testing.T) *BoltBackend {
+	t.Helper()
+	backend, err := OpenBoltBackend(filepath.Join(t.TempDir(), "history.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { backend.Close() })
+	return backend
+}
+
+func TestBoltUpdate(t *testing.T) {
+	backend := openTestBolt(t)
+	now := time.Unix(1600000000, 0)
+	for _, item := range []string{"a", "b", "c"} {
+		err := backend.Record(item, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := backend.Update(func(history History) error {
+		delete(history, "a")
+		history["b"] = Entry{Count: 5, LastUsed: now}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	history, err := backend.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := history["a"]; ok || history["b"].Count != 5 || history["c"].Count != 1 {
+		t.Errorf("Unexpected history after update %v", history)
+	}
+
+	failure := errors.New("failure")
+	err = backend.Update(func(history History) error {
+		delete(history, "c")
+		return failure
+	})
+	if err != failure {
+		t.Errorf("Expected the error of the update, got %v", err)
+	}
+	history, err = backend.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if history["c"].Count != 1 {
+		t.Errorf("Expected a failed update to leave the history alone, got %v", history)
+	}
+}
+
+func TestBoltReplace(t *testing.T) {
+	backend := openTestBolt(t)
+	now := time.Unix(1600000000, 0)
+	err := backend.Replace(History{"a": {Count: 1, LastUsed: now}, "b": {Count: 2, LastUsed: now}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = backend.Replace(History{"b": {Count: 3, LastUsed: now}, "c": {Count: 1, LastUsed: now}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	history, err := backend.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 2 || history["b"].Count != 3 || history["c"].Count != 1 {
+		t.Errorf("Unexpected history after replace %v", history)
+	}
+}
@@ -0,0 +1,262 @@
+package history
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"io/ioutil"
+
+	"github.com/femnad/mare"
+	"golang.org/x/crypto/scrypt"
+)
+
+// Encrypted histories start with a magic line, optionally followed by a label line in the clear,
+// then a byte naming how the key was derived, the salt for deriving it, the nonce and the
+// AES-256-GCM sealed history. Everything before the sealed history is authenticated along with it.
+const (
+	encryptedMagic = "stuff-history-encrypted\n"
+	kdfRawKey      = 0
+	kdfScrypt      = 1
+	keySize        = 32
+	saltSize       = 16
+	nonceSize      = 12
+	scryptN        = 1 << 15
+	scryptR        = 8
+	scryptP        = 1
+)
+
+var (
+	ErrNotEncrypted     = errors.New("history is not encrypted")
+	ErrMissingKey       = errors.New("history is encrypted but no key was given")
+	ErrUnknownKDF       = errors.New("unknown key derivation")
+	ErrWrongKeyKind     = errors.New("history was encrypted with a different kind of key")
+	ErrTruncatedHistory = errors.New("encrypted history is truncated")
+	ErrInvalidLabel     = errors.New("labels have to be JSON objects on a single line")
+)
+
+// Labels are JSON objects, which tells them apart from the key derivation byte of files without one.
+const labelStart = '{'
+
+// Cipher encrypts histories either with a key derived from a passphrase, using a fresh salt every
+// time, or with a key read from a key file.
+type Cipher struct {
+	passphrase []byte
+	key        []byte
+}
+
+func NewPassphraseCipher(passphrase []byte) *Cipher {
+	return &Cipher{passphrase: passphrase}
+}
+
+// NewKeyFileCipher uses the SHA-256 digest of the contents of the key file as the key, so any file
+// with enough entropy works as a key file.
+func NewKeyFileCipher(path string) (*Cipher, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key := sha256.Sum256(content)
+	return &Cipher{key: key[:]}, nil
+}
+
+// OpenCipher returns the cipher for a key file or a file holding a passphrase, of which at most one
+// can be given, or nil if neither is.
+func OpenCipher(keyFile, passphraseFile string) (*Cipher, error) {
+	switch {
+	case keyFile != "" && passphraseFile != "":
+		return nil, errors.New("Only one of a key file and a passphrase file can be given")
+	case keyFile != "":
+		return NewKeyFileCipher(mare.ExpandUser(keyFile))
+	case passphraseFile != "":
+		passphrase, err := ioutil.ReadFile(mare.ExpandUser(passphraseFile))
+		if err != nil {
+			return nil, err
+		}
+		return NewPassphraseCipher(bytes.TrimRight(passphrase, "\n")), nil
+	default:
+		return nil, nil
+	}
+}
+
+func IsEncrypted(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(encryptedMagic))
+}
+
+func (c *Cipher) kdf() byte {
+	if c.key != nil {
+		return kdfRawKey
+	}
+	return kdfScrypt
+}
+
+func (c *Cipher) deriveKey(kdf byte, salt []byte) ([]byte, error) {
+	switch kdf {
+	case kdfRawKey:
+		if c.key == nil {
+			return nil, ErrWrongKeyKind
+		}
+		return c.key, nil
+	case kdfScrypt:
+		if c.passphrase == nil {
+			return nil, ErrWrongKeyKind
+		}
+		return scrypt.Key(c.passphrase, salt, scryptN, scryptR, scryptP, keySize)
+	default:
+		return nil, ErrUnknownKDF
+	}
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func newSalt(kdf byte) ([]byte, error) {
+	salt := make([]byte, saltSize)
+	if kdf == kdfScrypt {
+		_, err := io.ReadFull(rand.Reader, salt)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return salt, nil
+}
+
+func (c *Cipher) Seal(plaintext []byte) ([]byte, error) {
+	return c.SealWithLabel(plaintext, nil)
+}
+
+// SealWithLabel seals plaintext, keeping label readable without the key, though no less
+// authenticated, for what has to be known about a history without decrypting it.
+func (c *Cipher) SealWithLabel(plaintext, label []byte) ([]byte, error) {
+	if len(label) > 0 && (label[0] != labelStart || bytes.IndexByte(label, '\n') >= 0) {
+		return nil, ErrInvalidLabel
+	}
+	kdf := c.kdf()
+	salt, err := newSalt(kdf)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, nonceSize)
+	_, err = io.ReadFull(rand.Reader, nonce)
+	if err != nil {
+		return nil, err
+	}
+	key, err := c.deriveKey(kdf, salt)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	header := []byte(encryptedMagic)
+	if len(label) > 0 {
+		header = append(append(header, label...), '\n')
+	}
+	header = append(header, kdf)
+	header = append(header, salt...)
+	header = append(header, nonce...)
+	return aead.Seal(header, nonce, plaintext, header), nil
+}
+
+// labelSize is the size of the label line of sealed, zero if it has none and negative if it is
+// cut short.
+func labelSize(sealed []byte) int {
+	rest := sealed[len(encryptedMagic):]
+	if len(rest) == 0 || rest[0] != labelStart {
+		return 0
+	}
+	end := bytes.IndexByte(rest, '\n')
+	if end < 0 {
+		return -1
+	}
+	return end + 1
+}
+
+// Label returns the label sealed was sealed with, nil if there is none. The label is only
+// authenticated by opening sealed.
+func Label(sealed []byte) []byte {
+	if !IsEncrypted(sealed) {
+		return nil
+	}
+	size := labelSize(sealed)
+	if size <= 0 {
+		return nil
+	}
+	return sealed[len(encryptedMagic) : len(encryptedMagic)+size-1]
+}
+
+func (c *Cipher) Open(sealed []byte) ([]byte, error) {
+	if !IsEncrypted(sealed) {
+		return nil, ErrNotEncrypted
+	}
+	size := labelSize(sealed)
+	if size < 0 {
+		return nil, ErrTruncatedHistory
+	}
+	keyStart := len(encryptedMagic) + size
+	headerSize := keyStart + 1 + saltSize + nonceSize
+	if len(sealed) < headerSize {
+		return nil, ErrTruncatedHistory
+	}
+	header := sealed[:headerSize]
+	kdf := header[keyStart]
+	salt := header[keyStart+1 : keyStart+1+saltSize]
+	nonce := header[headerSize-nonceSize:]
+
+	key, err := c.deriveKey(kdf, salt)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	return aead.Open(nil, nonce, sealed[headerSize:], header)
+}
+
+// sealer seals many small messages with a single derived key and a fresh nonce for each, for when
+// deriving a key per message, as Seal does, would take too long.
+type sealer struct {
+	aead       cipher.AEAD
+	additional []byte
+}
+
+// newSealer derives the key for kdf and salt once, authenticating additional along with every
+// message.
+func (c *Cipher) newSealer(kdf byte, salt, additional []byte) (*sealer, error) {
+	key, err := c.deriveKey(kdf, salt)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	return &sealer{aead: aead, additional: additional}, nil
+}
+
+func (s *sealer) seal(plaintext []byte) ([]byte, error) {
+	nonce := make([]byte, nonceSize)
+	_, err := io.ReadFull(rand.Reader, nonce)
+	if err != nil {
+		return nil, err
+	}
+	return s.aead.Seal(nonce, nonce, plaintext, s.additional), nil
+}
+
+func (s *sealer) open(sealed []byte) ([]byte, error) {
+	if len(sealed) < nonceSize {
+		return nil, ErrTruncatedHistory
+	}
+	return s.aead.Open(nil, sealed[:nonceSize], sealed[nonceSize:], s.additional)
+}
@@ -0,0 +1,190 @@
+package history
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeKeyFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "key")
+	err := ioutil.WriteFile(path, []byte(content), storeFileMode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func newKeyFileCipher(t *testing.T, content string) *Cipher {
+	t.Helper()
+	c, err := NewKeyFileCipher(writeKeyFile(t, content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func readStoreFile(t *testing.T, store *Store) []byte {
+	t.Helper()
+	content, err := ioutil.ReadFile(store.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return content
+}
+
+func TestEncryptedStoreRoundTrip(t *testing.T) {
+	keyFile := writeKeyFile(t, "key material")
+	for _, c := range []struct {
+		kind string
+		open func() (*Cipher, error)
+	}{
+		{"passphrase", func() (*Cipher, error) { return NewPassphraseCipher([]byte("secret")), nil }},
+		{"key file", func() (*Cipher, error) { return NewKeyFileCipher(keyFile) }},
+	} {
+		sealing, err := c.open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(t.TempDir(), "history")
+		store := NewEncryptedStore(path, sealing)
+		err = store.Record("work/My Bank.gpg", time.Unix(1600000000, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		content := readStoreFile(t, store)
+		if !IsEncrypted(content) || bytes.Contains(content, []byte("Bank")) {
+			t.Errorf("Expected the history encrypted with a %s to be encrypted", c.kind)
+		}
+
+		opening, err := c.open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		history, err := NewEncryptedStore(path, opening).Load()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if history["work/My Bank.gpg"].Count != 1 {
+			t.Errorf("Unexpected history encrypted with a %s %v", c.kind, history)
+		}
+	}
+}
+
+func TestOpenWithWrongKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history")
+	err := NewEncryptedStore(path, NewPassphraseCipher([]byte("secret"))).Record("a", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = NewEncryptedStore(path, NewPassphraseCipher([]byte("wrong"))).Load()
+	if err == nil {
+		t.Error("Expected a wrong passphrase to fail")
+	}
+	_, err = NewEncryptedStore(path, newKeyFileCipher(t, "key material")).Load()
+	if !errors.Is(err, ErrWrongKeyKind) {
+		t.Errorf("Expected %v for a key file, got %v", ErrWrongKeyKind, err)
+	}
+	_, err = NewStore(path).Load()
+	if !errors.Is(err, ErrMissingKey) {
+		t.Errorf("Expected %v without a key, got %v", ErrMissingKey, err)
+	}
+
+	sealed, err := newKeyFileCipher(t, "key material").Seal([]byte("history"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = newKeyFileCipher(t, "other key material").Open(sealed)
+	if err == nil {
+		t.Error("Expected a wrong key file to fail")
+	}
+	_, err = NewPassphraseCipher([]byte("secret")).Open(sealed)
+	if !errors.Is(err, ErrWrongKeyKind) {
+		t.Errorf("Expected %v for a passphrase, got %v", ErrWrongKeyKind, err)
+	}
+}
+
+func TestOpenTampered(t *testing.T) {
+	c := newKeyFileCipher(t, "key material")
+	label := []byte(`{"version":2}`)
+	sealed, err := c.SealWithLabel([]byte("history"), label)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(Label(sealed), label) {
+		t.Errorf("Expected the label %s, got %s", label, Label(sealed))
+	}
+	opened, err := c.Open(sealed)
+	if err != nil || string(opened) != "history" {
+		t.Fatalf("Expected the sealed history back, got %q, %v", opened, err)
+	}
+
+	relabeled := bytes.Replace(sealed, label, []byte(`{"version":3}`), 1)
+	_, err = c.Open(relabeled)
+	if err == nil {
+		t.Error("Expected a changed label to fail")
+	}
+	changed := append([]byte(nil), sealed...)
+	changed[len(changed)-1] ^= 1
+	_, err = c.Open(changed)
+	if err == nil {
+		t.Error("Expected a changed ciphertext to fail")
+	}
+	_, err = c.Open(sealed[:len(encryptedMagic)+len(label)+1+saltSize])
+	if !errors.Is(err, ErrTruncatedHistory) {
+		t.Errorf("Expected %v, got %v", ErrTruncatedHistory, err)
+	}
+	_, err = c.SealWithLabel([]byte("history"), []byte("not json"))
+	if !errors.Is(err, ErrInvalidLabel) {
+		t.Errorf("Expected %v, got %v", ErrInvalidLabel, err)
+	}
+}
+
+func TestRekeyStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history")
+	store := NewStore(path)
+	err := store.Record("a", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = Rekey(store, NewPassphraseCipher([]byte("secret")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsEncrypted(readStoreFile(t, store)) {
+		t.Fatal("Expected rekeying to encrypt the history")
+	}
+	// The store keeps using the new key.
+	err = store.Record("a", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypted := NewEncryptedStore(path, NewPassphraseCipher([]byte("secret")))
+	history, err := encrypted.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if history["a"].Count != 2 {
+		t.Errorf("Unexpected encrypted history %v", history)
+	}
+
+	err = Rekey(encrypted, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if IsEncrypted(readStoreFile(t, store)) {
+		t.Fatal("Expected rekeying without a key to decrypt the history")
+	}
+	history, err = NewStore(path).Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if history["a"].Count != 2 {
+		t.Errorf("Unexpected decrypted history %v", history)
+	}
+}
@@ -0,0 +1,131 @@
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+const maxMessageSize = 64 * 1024 * 1024
+
+// Client talks to a history service and implements Backend on top of it, so it can be used in place
+// of direct file access.
+type Client struct {
+	*connection
+	namespace string
+}
+
+type connection struct {
+	conn    net.Conn
+	scanner *bufio.Scanner
+	mutex   sync.Mutex
+}
+
+func Dial(socketPath string) (*Client, error) {
+	conn, err := net.DialTimeout("unix", socketPath, dialTimeout)
+	if err != nil {
+		return nil, err
+	}
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 0, bufio.MaxScanTokenSize), maxMessageSize)
+	return &Client{connection: &connection{conn: conn, scanner: scanner}}, nil
+}
+
+// DialOrOpen connects to the history service at socketPath, or opens a backend with open when
+// the service is not running.
+func DialOrOpen(socketPath string, open func() (Backend, error)) (Backend, error) {
+	client, err := Dial(socketPath)
+	if err == nil {
+		return client, nil
+	}
+	if !isConnectionRefused(err) {
+		return nil, err
+	}
+	return open()
+}
+
+// WithNamespace returns a client for the given namespace sharing the connection of c, so the
+// service does the namespace filtering. Closing any of the clients closes the connection.
+func (c *Client) WithNamespace(namespace string) *Client {
+	return &Client{connection: c.connection, namespace: namespace}
+}
+
+func (c *Client) do(req request) (response, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	req.Namespace = c.namespace
+	line, err := json.Marshal(req)
+	if err != nil {
+		return response{}, err
+	}
+	_, err = c.conn.Write(append(line, '\n'))
+	if err != nil {
+		return response{}, err
+	}
+	if !c.scanner.Scan() {
+		err = c.scanner.Err()
+		if err == nil {
+			err = errors.New("history service closed the connection")
+		}
+		return response{}, err
+	}
+	var resp response
+	err = json.Unmarshal(c.scanner.Bytes(), &resp)
+	if err != nil {
+		return response{}, err
+	}
+	if resp.Error != "" {
+		return response{}, errors.New(resp.Error)
+	}
+	return resp, nil
+}
+
+func (c *Client) Load() (History, error) {
+	resp, err := c.do(request{Op: LoadRequest})
+	if err != nil {
+		return nil, err
+	}
+	return fromRecords(resp.History), nil
+}
+
+func (c *Client) Record(item string, when time.Time) error {
+	_, err := c.do(request{Op: RecordRequest, Item: item, When: toUnix(when)})
+	return err
+}
+
+func (c *Client) Put(item string, entry Entry) error {
+	entryRecord := toRecord(item, entry)
+	_, err := c.do(request{Op: PutRequest, Item: item, Entry: &entryRecord})
+	return err
+}
+
+func (c *Client) Forget(item string) error {
+	_, err := c.do(request{Op: ForgetRequest, Item: item})
+	return err
+}
+
+func (c *Client) Replace(history History) error {
+	_, err := c.do(request{Op: ReplaceRequest, History: toRecords(history)})
+	return err
+}
+
+// Ranked returns the items of the namespace ordered by ranking, as understood by ParseRanking,
+// limited to the best limit items if limit is positive.
+func (c *Client) Ranked(ranking string, limit int) ([]string, error) {
+	resp, err := c.do(request{Op: RankedRequest, Ranking: ranking, Limit: limit})
+	return resp.Items, err
+}
+
+// Query runs Query in the service with the namespace's history and frecency as usage.
+func (c *Client) Query(candidates []string, search string, limit int) ([]string, error) {
+	resp, err := c.do(request{Op: QueryRequest, Candidates: candidates, Search: search, Limit: limit})
+	return resp.Items, err
+}
+
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
@@ -0,0 +1,228 @@
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// The history service speaks newline delimited JSON over a Unix domain socket: every request line
+// is answered by exactly one response line, and a connection can carry any number of requests.
+const (
+	LoadRequest    = "load"
+	RecordRequest  = "record"
+	PutRequest     = "put"
+	ForgetRequest  = "forget"
+	ReplaceRequest = "replace"
+	RankedRequest  = "ranked"
+	QueryRequest   = "query"
+
+	socketFileName = "stuff-history.sock"
+	socketMode     = 0600
+	dialTimeout    = time.Second
+)
+
+type request struct {
+	Op         string   `json:"op"`
+	Namespace  string   `json:"namespace,omitempty"`
+	Item       string   `json:"item,omitempty"`
+	When       int64    `json:"when,omitempty"`
+	Entry      *record  `json:"entry,omitempty"`
+	History    []record `json:"history,omitempty"`
+	Ranking    string   `json:"ranking,omitempty"`
+	Limit      int      `json:"limit,omitempty"`
+	Candidates []string `json:"candidates,omitempty"`
+	Search     string   `json:"search,omitempty"`
+}
+
+type response struct {
+	Error   string   `json:"error,omitempty"`
+	Items   []string `json:"items,omitempty"`
+	History []record `json:"history,omitempty"`
+}
+
+func toRecords(history History) []record {
+	records := make([]record, 0, len(history))
+	for _, item := range sortedItems(history) {
+		records = append(records, toRecord(item, history[item]))
+	}
+	return records
+}
+
+func fromRecords(records []record) History {
+	history := make(History, len(records))
+	for _, r := range records {
+		history[r.Item] = r.entry()
+	}
+	return history
+}
+
+// DefaultSocketPath is in the user's runtime directory if there is one.
+func DefaultSocketPath() string {
+	runtimeDir := os.Getenv("XDG_RUNTIME_DIR")
+	if runtimeDir != "" {
+		return filepath.Join(runtimeDir, socketFileName)
+	}
+	return filepath.Join(os.TempDir(), fmt.Sprintf("%s-%d", socketFileName, os.Getuid()))
+}
+
+// Server answers history requests from a single backend, one request at a time.
+type Server struct {
+	backend Backend
+	mutex   sync.Mutex
+}
+
+func NewServer(backend Backend) *Server {
+	return &Server{backend: backend}
+}
+
+func (s *Server) rank(namespace Backend, req request) ([]string, error) {
+	history, err := namespace.Load()
+	if err != nil {
+		return nil, err
+	}
+	ranking := req.Ranking
+	if ranking == "" {
+		ranking = DefaultRanking
+	}
+	ranker, err := ParseRanking(ranking, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if req.Limit > 0 {
+		return RankTop(history, ranker, req.Limit), nil
+	}
+	return Rank(history, ranker), nil
+}
+
+func (s *Server) query(namespace Backend, req request) ([]string, error) {
+	history, err := namespace.Load()
+	if err != nil {
+		return nil, err
+	}
+	matches := Query(req.Candidates, req.Search, history, FrecencyScorer(time.Now(), DefaultHalfLife))
+	if req.Limit > 0 && len(matches) > req.Limit {
+		matches = matches[:req.Limit]
+	}
+	items := make([]string, 0, len(matches))
+	for _, match := range matches {
+		items = append(items, match.Item)
+	}
+	return items, nil
+}
+
+// recordTime returns the time of a recorded use, which is when the request arrives for clients
+// that leave it out.
+func recordTime(when int64) time.Time {
+	if when == 0 {
+		return time.Now()
+	}
+	return fromUnix(when)
+}
+
+func (s *Server) handle(req request) response {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	namespace := Namespace(s.backend, req.Namespace)
+	var err error
+	var resp response
+	switch req.Op {
+	case LoadRequest:
+		var history History
+		history, err = namespace.Load()
+		resp.History = toRecords(history)
+	case RecordRequest:
+		err = namespace.Record(req.Item, recordTime(req.When))
+	case PutRequest:
+		if req.Entry == nil {
+			err = errors.New("put request without an entry")
+		} else {
+			err = namespace.Put(req.Item, req.Entry.entry())
+		}
+	case ForgetRequest:
+		err = namespace.Forget(req.Item)
+	case ReplaceRequest:
+		err = namespace.Replace(fromRecords(req.History))
+	case RankedRequest:
+		resp.Items, err = s.rank(namespace, req)
+	case QueryRequest:
+		resp.Items, err = s.query(namespace, req)
+	default:
+		err = fmt.Errorf("unknown request %s", req.Op)
+	}
+	if err != nil {
+		return response{Error: err.Error()}
+	}
+	return resp
+}
+
+func (s *Server) serveConn(conn net.Conn) {
+	defer conn.Close()
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 0, bufio.MaxScanTokenSize), maxMessageSize)
+	encoder := json.NewEncoder(conn)
+	for scanner.Scan() {
+		var req request
+		var resp response
+		err := json.Unmarshal(scanner.Bytes(), &req)
+		if err != nil {
+			resp = response{Error: err.Error()}
+		} else {
+			resp = s.handle(req)
+		}
+		err = encoder.Encode(resp)
+		if err != nil {
+			return
+		}
+	}
+}
+
+// Serve accepts connections on listener until it is closed.
+func (s *Server) Serve(listener net.Listener) error {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+		go s.serveConn(conn)
+	}
+}
+
+func isConnectionRefused(err error) bool {
+	return errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ENOENT)
+}
+
+// Listen listens on a Unix domain socket at socketPath that only the current user can connect to.
+// A socket left behind by a service that is no longer running is replaced, a live one is not.
+func Listen(socketPath string) (net.Listener, error) {
+	conn, err := net.DialTimeout("unix", socketPath, dialTimeout)
+	if err == nil {
+		conn.Close()
+		return nil, fmt.Errorf("History service is already listening on %s", socketPath)
+	}
+	if isConnectionRefused(err) {
+		os.Remove(socketPath)
+	}
+	err = os.MkdirAll(filepath.Dir(socketPath), storeDirMode)
+	if err != nil {
+		return nil, err
+	}
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return nil, err
+	}
+	err = os.Chmod(socketPath, socketMode)
+	if err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return listener, nil
+}
@@ -0,0 +1,120 @@
+package history
+
+import (
+	"encoding/json"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func startServer(t *testing.T, backend Backend) string {
+	t.Helper()
+	socketPath := filepath.Join(t.TempDir(), "history.sock")
+	listener, err := Listen(socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go NewServer(backend).Serve(listener)
+	return socketPath
+}
+
+func TestNamespaceThroughService(t *testing.T) {
+	backend := NewMemoryBackend(make(History))
+	client, err := Dial(startServer(t, backend))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	now := time.Now()
+	err = Namespace(client, "team").Record("site", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = Namespace(client, RootNamespace).Record("other", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	namespaced, err := Namespace(client, "team").Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(namespaced) != 1 || namespaced["site"].Count != 1 {
+		t.Errorf("Expected only site in the team namespace, got %v", namespaced)
+	}
+	root, err := Namespace(client, RootNamespace).Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(root) != 1 || root["other"].Count != 1 {
+		t.Errorf("Expected only other in the root namespace, got %v", root)
+	}
+
+	stored, err := backend.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := stored[namespacedKey("team", "site")]; !ok {
+		t.Errorf("Expected site to be stored in the team namespace, got %v", stored)
+	}
+}
+
+func TestNamespaceReplaceThroughService(t *testing.T) {
+	backend := NewMemoryBackend(History{
+		namespacedKey("team", "old"): {Count: 1},
+		"kept":                       {Count: 2},
+	})
+	client, err := Dial(startServer(t, backend))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	err = Namespace(client, "team").Replace(History{"new": {Count: 3}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored, err := backend.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, hasOld := stored[namespacedKey("team", "old")]
+	if hasOld || stored[namespacedKey("team", "new")].Count != 3 || stored["kept"].Count != 2 {
+		t.Errorf("Expected only the team namespace to be replaced, got %v", stored)
+	}
+}
+
+func TestRecordWithoutTime(t *testing.T) {
+	backend := NewMemoryBackend(make(History))
+	conn, err := net.Dial("unix", startServer(t, backend))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	before := time.Now().Truncate(time.Second)
+	_, err = conn.Write([]byte(`{"op":"record","item":"x"}` + "\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var resp response
+	err = json.NewDecoder(conn).Decode(&resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Error != "" {
+		t.Fatal(resp.Error)
+	}
+
+	stored, err := backend.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry := stored["x"]
+	if entry.Count != 1 || entry.LastUsed.Before(before) || len(entry.Recent) != 1 || entry.Recent[0].Before(before) {
+		t.Errorf("Expected the use to be recorded now, got %v", entry)
+	}
+}
@@ -0,0 +1,28 @@
+package history
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrEmptyItem          = errors.New("empty item")
+	ErrNegativeCount      = errors.New("negative count")
+	ErrUnexpectedLine     = errors.New("unexpected line")
+	ErrUnsupportedVersion = errors.New("unsupported history format version")
+)
+
+// ParseError describes a history line that could not be decoded.
+type ParseError struct {
+	Line int
+	Text string
+	Err  error
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("line %d: %v: %q", e.Line, e.Err, e.Text)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
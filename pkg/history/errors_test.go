@@ -0,0 +1,88 @@
+package history
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const badHistory = "web/site 3\nmail 2\nnot-a-count\nwork 1\n"
+
+func TestLoadStopsAtBadLine(t *testing.T) {
+	history, err := Load(strings.NewReader(badHistory))
+	if history != nil {
+		t.Errorf("Expected no history, got %v", history)
+	}
+	if !errors.Is(err, ErrUnexpectedLine) {
+		t.Fatalf("Expected %v, got %v", ErrUnexpectedLine, err)
+	}
+	var parseError *ParseError
+	if !errors.As(err, &parseError) {
+		t.Fatalf("Expected a parse error, got %T", err)
+	}
+	if parseError.Line != 3 || parseError.Text != "not-a-count" {
+		t.Errorf("Expected line 3 with the bad text, got line %d with %q", parseError.Line, parseError.Text)
+	}
+	if message := err.Error(); message != `line 3: unexpected line: "not-a-count"` {
+		t.Errorf("Unexpected error message %s", message)
+	}
+}
+
+func TestLoadLenientSkipsBadLines(t *testing.T) {
+	history, parseErrors, err := LoadLenient(strings.NewReader(badHistory + `{"item":"x"` + "\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 3 || history["web/site"].Count != 3 || history["mail"].Count != 2 || history["work"].Count != 1 {
+		t.Errorf("Expected the good lines to load, got %v", history)
+	}
+	if len(parseErrors) != 2 {
+		t.Fatalf("Expected 2 parse errors, got %v", parseErrors)
+	}
+	if parseErrors[0].Line != 3 || !errors.Is(parseErrors[0], ErrUnexpectedLine) {
+		t.Errorf("Unexpected first parse error %v", parseErrors[0])
+	}
+	if parseErrors[1].Line != 5 || parseErrors[1].Text != `{"item":"x"` {
+		t.Errorf("Unexpected second parse error %v", parseErrors[1])
+	}
+}
+
+func TestStoreOnParseError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history")
+	err := ioutil.WriteFile(path, []byte(badHistory), storeFileMode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = NewStore(path).Load()
+	if !errors.Is(err, ErrUnexpectedLine) {
+		t.Errorf("Expected a strict store to fail with %v, got %v", ErrUnexpectedLine, err)
+	}
+
+	var reported []*ParseError
+	store := NewStore(path)
+	store.OnParseError = func(parseError *ParseError) {
+		reported = append(reported, parseError)
+	}
+	history, err := store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 3 || len(reported) != 1 || reported[0].Line != 3 {
+		t.Errorf("Expected the bad line to be reported and skipped, got %v and %v", history, reported)
+	}
+
+	err = store.Record("mail", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	history, err = NewStore(path).Load()
+	if err != nil {
+		t.Fatalf("Expected the bad line to be dropped on update, got %v", err)
+	}
+	if history["mail"].Count != 3 || history["web/site"].Count != 3 {
+		t.Errorf("Unexpected history after the update %v", history)
+	}
+}
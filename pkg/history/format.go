@@ -0,0 +1,269 @@
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Files written before the format was versioned have no header and hold one `item count` line per
+// item, optionally followed by the last use time and the recent use times.
+const (
+	formatName      = "stuff-history"
+	legacyVersion   = 1
+	CurrentVersion  = 2
+	noRecentUses    = "-"
+	recentSeparator = ","
+	maxLineSize     = 1024 * 1024
+)
+
+type header struct {
+	Format  string `json:"format"`
+	Version int    `json:"version"`
+	// Journal names the last journal whose events are already part of the history.
+	Journal string `json:"journal,omitempty"`
+}
+
+func newHeader() header {
+	return header{Format: formatName, Version: CurrentVersion}
+}
+
+type record struct {
+	Item      string         `json:"item"`
+	Count     int            `json:"count"`
+	LastUsed  int64          `json:"last_used,omitempty"`
+	Recent    []int64        `json:"recent,omitempty"`
+	DecayedAt int64          `json:"decayed_at,omitempty"`
+	Devices   map[string]int `json:"devices,omitempty"`
+}
+
+type lineDecoder func(line string) (string, Entry, error)
+
+var decoders = map[int]lineDecoder{
+	legacyVersion: decodeLegacyLine,
+	2:             decodeRecordLine,
+}
+
+func toUnix(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
+
+func fromUnix(seconds int64) time.Time {
+	if seconds == 0 {
+		return time.Time{}
+	}
+	return time.Unix(seconds, 0)
+}
+
+func toRecord(item string, entry Entry) record {
+	r := record{Item: item, Count: entry.Count, LastUsed: toUnix(entry.LastUsed), DecayedAt: toUnix(entry.DecayedAt),
+		Devices: entry.Devices}
+	for _, used := range entry.Recent {
+		r.Recent = append(r.Recent, toUnix(used))
+	}
+	return r
+}
+
+func (r record) entry() Entry {
+	entry := Entry{Count: r.Count, LastUsed: fromUnix(r.LastUsed), DecayedAt: fromUnix(r.DecayedAt),
+		Devices: r.Devices}
+	for _, used := range r.Recent {
+		entry.Recent = append(entry.Recent, fromUnix(used))
+	}
+	return entry
+}
+
+func sortedItems(history History) []string {
+	items := make([]string, 0, len(history))
+	for item := range history {
+		items = append(items, item)
+	}
+	sort.Strings(items)
+	return items
+}
+
+func writeJSONLine(writer io.Writer, value interface{}) error {
+	line, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	_, err = writer.Write(append(line, '\n'))
+	return err
+}
+
+func encode(writer io.Writer, history History, h header) error {
+	err := writeJSONLine(writer, h)
+	if err != nil {
+		return err
+	}
+	for _, item := range sortedItems(history) {
+		err = writeJSONLine(writer, toRecord(item, history[item]))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func parseHeader(line string) (header, bool) {
+	var h header
+	if !strings.HasPrefix(line, "{") {
+		return h, false
+	}
+	err := json.Unmarshal([]byte(line), &h)
+	if err != nil || h.Format != formatName {
+		return h, false
+	}
+	return h, true
+}
+
+func decodeRecordLine(line string) (string, Entry, error) {
+	var r record
+	err := json.Unmarshal([]byte(line), &r)
+	if err != nil {
+		return "", Entry{}, err
+	}
+	if r.Item == "" {
+		return "", Entry{}, ErrEmptyItem
+	}
+	if r.Count < 0 {
+		return "", Entry{}, ErrNegativeCount
+	}
+	return r.Item, r.entry(), nil
+}
+
+func parseUnixTime(value string) (time.Time, error) {
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return fromUnix(seconds), nil
+}
+
+func parseRecentUses(value string) ([]time.Time, error) {
+	if value == noRecentUses {
+		return nil, nil
+	}
+	recent := make([]time.Time, 0)
+	for _, field := range strings.Split(value, recentSeparator) {
+		used, err := parseUnixTime(field)
+		if err != nil {
+			return nil, err
+		}
+		recent = append(recent, used)
+	}
+	return recent, nil
+}
+
+func parseCount(value string) (int, error) {
+	count, err := strconv.ParseInt(value, 10, 64)
+	return int(count), err
+}
+
+func parseTimedLegacyFields(fields []string) (Entry, error) {
+	count, err := parseCount(fields[0])
+	if err != nil {
+		return Entry{}, err
+	}
+	lastUsed, err := parseUnixTime(fields[1])
+	if err != nil {
+		return Entry{}, err
+	}
+	recent, err := parseRecentUses(fields[2])
+	if err != nil {
+		return Entry{}, err
+	}
+	return Entry{Count: count, LastUsed: lastUsed, Recent: recent}, nil
+}
+
+// Legacy lines were split on single spaces, so an item containing spaces is recovered by reading
+// the numeric fields from the end of the line.
+func decodeLegacyLine(line string) (string, Entry, error) {
+	fields := strings.Split(strings.TrimSpace(line), " ")
+	numFields := len(fields)
+	if numFields >= 4 {
+		entry, err := parseTimedLegacyFields(fields[numFields-3:])
+		if err == nil {
+			return strings.Join(fields[:numFields-3], " "), entry, nil
+		}
+	}
+	if numFields >= 2 {
+		count, err := parseCount(fields[numFields-1])
+		if err == nil {
+			return strings.Join(fields[:numFields-1], " "), Entry{Count: count}, nil
+		}
+	}
+	return "", Entry{}, ErrUnexpectedLine
+}
+
+// decode reads a history in any known format version. Lines that cannot be decoded abort decoding
+// unless lenient is set, in which case they are skipped and returned as parse errors.
+func decode(reader io.Reader, lenient bool) (History, header, []*ParseError, error) {
+	var fileHeader header
+	history := make(History)
+	parseErrors := make([]*ParseError, 0)
+	decoder := decoders[legacyVersion]
+	firstLine := true
+	lineNumber := 0
+
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, bufio.MaxScanTokenSize), maxLineSize)
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" {
+			continue
+		}
+		if firstLine {
+			firstLine = false
+			h, ok := parseHeader(line)
+			if ok {
+				decoder, ok = decoders[h.Version]
+				if !ok {
+					return nil, fileHeader, nil, &ParseError{Line: lineNumber, Text: line, Err: ErrUnsupportedVersion}
+				}
+				fileHeader = h
+				continue
+			}
+		}
+		item, entry, err := decoder(line)
+		if err != nil {
+			parseError := &ParseError{Line: lineNumber, Text: line, Err: err}
+			if !lenient {
+				return nil, fileHeader, nil, parseError
+			}
+			parseErrors = append(parseErrors, parseError)
+			continue
+		}
+		history[item] = entry
+	}
+	err := scanner.Err()
+	if err != nil {
+		return nil, fileHeader, nil, err
+	}
+	return history, fileHeader, parseErrors, nil
+}
+
+// Load reads a history and fails on the first line that cannot be decoded.
+func Load(reader io.Reader) (History, error) {
+	history, _, _, err := decode(reader, false)
+	return history, err
+}
+
+// LoadLenient reads a history, skipping lines that cannot be decoded and returning them as parse
+// errors. The returned error is only set for failures that prevent reading the history at all.
+func LoadLenient(reader io.Reader) (History, []*ParseError, error) {
+	history, _, parseErrors, err := decode(reader, true)
+	return history, parseErrors, err
+}
+
+func Save(writer io.Writer, history History) error {
+	return encode(writer, history, newHeader())
+}
@@ -0,0 +1,91 @@
+package history
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadLegacyHistory(t *testing.T) {
+	history, err := Load(strings.NewReader("web/site 3\nwork/My Bank.gpg 5\nmail 2 1600000000 1599999000,1600000000\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := History{
+		"web/site":         {Count: 3},
+		"work/My Bank.gpg": {Count: 5},
+		"mail": {Count: 2, LastUsed: time.Unix(1600000000, 0),
+			Recent: []time.Time{time.Unix(1599999000, 0), time.Unix(1600000000, 0)}},
+	}
+	if !reflect.DeepEqual(history, expected) {
+		t.Errorf("Expected %v, got %v", expected, history)
+	}
+
+	var saved bytes.Buffer
+	err = Save(&saved, history)
+	if err != nil {
+		t.Fatal(err)
+	}
+	firstLine := strings.SplitN(saved.String(), "\n", 2)[0]
+	h, ok := parseHeader(firstLine)
+	if !ok || h.Version != CurrentVersion {
+		t.Errorf("Expected a version %d header, got %s", CurrentVersion, firstLine)
+	}
+	reloaded, err := Load(&saved)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(reloaded, expected) {
+		t.Errorf("Expected the saved history to load as %v, got %v", expected, reloaded)
+	}
+}
+
+func TestItemWithSpacesRoundTrips(t *testing.T) {
+	item := "work/My Bank.gpg"
+	history := make(History)
+	AddToHistoryAt(history, item, time.Unix(1600000000, 0))
+
+	var saved bytes.Buffer
+	err := Save(&saved, history)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reloaded, err := Load(&saved)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(reloaded, history) {
+		t.Errorf("Expected %v, got %v", history, reloaded)
+	}
+}
+
+func TestUnsupportedVersion(t *testing.T) {
+	_, err := Load(strings.NewReader(`{"format":"stuff-history","version":99}` + "\n" + `{"item":"a","count":1}` + "\n"))
+	if !errors.Is(err, ErrUnsupportedVersion) {
+		t.Errorf("Expected %v, got %v", ErrUnsupportedVersion, err)
+	}
+	var parseError *ParseError
+	if !errors.As(err, &parseError) || parseError.Line != 1 {
+		t.Errorf("Expected the error on the first line, got %v", err)
+	}
+}
+
+func TestLoadCRLFAndBlankLines(t *testing.T) {
+	for _, content := range []string{
+		"\r\nweb/site 3\r\n\r\nmail 2\r\n",
+		"{\"format\":\"stuff-history\",\"version\":2}\r\n\r\n{\"item\":\"web/site\",\"count\":3}\r\n\n" +
+			"{\"item\":\"mail\",\"count\":2}\r\n",
+	} {
+		history, err := Load(strings.NewReader(content))
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := History{"web/site": {Count: 3}, "mail": {Count: 2}}
+		if !reflect.DeepEqual(history, expected) {
+			t.Errorf("Expected %v for %q, got %v", expected, content, history)
+		}
+	}
+}
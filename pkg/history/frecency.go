@@ -0,0 +1,41 @@
+package history
+
+import (
+	"math"
+	"time"
+)
+
+// DefaultHalfLife is the age at which a single use counts half as much as a use right now.
+const DefaultHalfLife = 7 * 24 * time.Hour
+
+func decay(age, halfLife time.Duration) float64 {
+	if age < 0 {
+		age = 0
+	}
+	return math.Pow(0.5, float64(age)/float64(halfLife))
+}
+
+// FrecencyScore weighs every recorded use of an entry by its age. Uses older than the ones kept in
+// Recent are assumed to have happened no later than the oldest recent use.
+func FrecencyScore(entry Entry, now time.Time, halfLife time.Duration) float64 {
+	score := 0.0
+	for _, used := range entry.Recent {
+		score += decay(now.Sub(used), halfLife)
+	}
+	olderUses := entry.Count - len(entry.Recent)
+	if olderUses <= 0 {
+		return score
+	}
+	oldestKnownUse := entry.LastUsed
+	if len(entry.Recent) > 0 {
+		oldestKnownUse = entry.Recent[0]
+	}
+	if oldestKnownUse.IsZero() {
+		return score
+	}
+	return score + float64(olderUses)*decay(now.Sub(oldestKnownUse), halfLife)
+}
+
+func GetOrderedHistoryByFrecency(history History, now time.Time, halfLife time.Duration) []string {
+	return Rank(history, Then(ByFrecency(now, halfLife), ByCount, Alphabetical))
+}
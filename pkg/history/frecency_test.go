@@ -0,0 +1,66 @@
+package history
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+var frecencyNow = time.Unix(1700000000, 0)
+
+func TestRecentUseBeatsOldCount(t *testing.T) {
+	old := Entry{Count: 50, LastUsed: frecencyNow.Add(-90 * 24 * time.Hour)}
+	recent := make(History)
+	AddToHistoryAt(recent, "recent", frecencyNow.Add(-time.Hour))
+
+	oldScore := FrecencyScore(old, frecencyNow, DefaultHalfLife)
+	recentScore := FrecencyScore(recent["recent"], frecencyNow, DefaultHalfLife)
+	if recentScore <= oldScore {
+		t.Errorf("Expected a use an hour ago (%f) to beat 50 uses 90 days ago (%f)", recentScore, oldScore)
+	}
+
+	history := History{"old": old, "recent": recent["recent"]}
+	ordered := GetOrderedHistoryByFrecency(history, frecencyNow, DefaultHalfLife)
+	if ordered[0] != "recent" {
+		t.Errorf("Expected the recent entry first, got %v", ordered)
+	}
+}
+
+func TestUsesOlderThanRecentAreDecayed(t *testing.T) {
+	oldest := frecencyNow.Add(-DefaultHalfLife)
+	entry := Entry{Count: 5, LastUsed: frecencyNow, Recent: []time.Time{oldest, frecencyNow}}
+	// Both recent uses count by their age, the other three as if they happened at the oldest one.
+	expected := 1 + 0.5 + 3*0.5
+	if score := FrecencyScore(entry, frecencyNow, DefaultHalfLife); math.Abs(score-expected) > 1e-9 {
+		t.Errorf("Expected a score of %f, got %f", expected, score)
+	}
+
+	legacy := Entry{Count: 4, LastUsed: oldest}
+	if score := FrecencyScore(legacy, frecencyNow, DefaultHalfLife); math.Abs(score-2) > 1e-9 {
+		t.Errorf("Expected uses without recent times to decay from the last use, got %f", score)
+	}
+	if score := FrecencyScore(Entry{Count: 4}, frecencyNow, DefaultHalfLife); score != 0 {
+		t.Errorf("Expected no score without any use time, got %f", score)
+	}
+}
+
+func TestRecentUsesAreCapped(t *testing.T) {
+	history := make(History)
+	for i := 0; i < 2*maxRecentUses; i++ {
+		AddToHistoryAt(history, "item", frecencyNow.Add(time.Duration(i)*time.Minute))
+	}
+	entry := history["item"]
+	if entry.Count != 2*maxRecentUses {
+		t.Errorf("Expected %d uses, got %d", 2*maxRecentUses, entry.Count)
+	}
+	if len(entry.Recent) != maxRecentUses {
+		t.Fatalf("Expected %d recent uses, got %d", maxRecentUses, len(entry.Recent))
+	}
+	if first := frecencyNow.Add(maxRecentUses * time.Minute); !entry.Recent[0].Equal(first) {
+		t.Errorf("Expected the oldest uses to be dropped, got %v", entry.Recent[0])
+	}
+	last := frecencyNow.Add((2*maxRecentUses - 1) * time.Minute)
+	if !entry.LastUsed.Equal(last) || !entry.Recent[maxRecentUses-1].Equal(last) {
+		t.Errorf("Expected the last use at %v, got %v", last, entry.LastUsed)
+	}
+}
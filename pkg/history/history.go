@@ -2,31 +2,25 @@ package history
 
 import (
 	"bufio"
-	"fmt"
 	"github.com/femnad/mare"
-	"io"
 	"os"
 	"sort"
-	"strconv"
-	"strings"
+	"time"
 )
 
-type History map[string]int
-type reverseHistory map[int][]string
+const maxRecentUses = 10
 
-type intSet map[int]bool
-
-func addToSet(set intSet, item int) {
-	set[item] = true
+type Entry struct {
+	Count     int
+	LastUsed  time.Time
+	Recent    []time.Time
+	DecayedAt time.Time
+	// Devices holds the part of Count that was recorded on each device. Counts from before devices
+	// were tracked are not attributed to any device.
+	Devices map[string]int
 }
 
-func getSetAsSlice(set intSet) []int {
-	items := make([]int, 0)
-	for item, _ := range set {
-		items = append(items, item)
-	}
-	return items
-}
+type History map[string]Entry
 
 func IsInHistory(history History, item string) bool {
 	_, ok := history[item]
@@ -34,79 +28,49 @@ func IsInHistory(history History, item string) bool {
 }
 
 func AddToHistory(history History, item string) {
-	if IsInHistory(history, item) {
-		history[item] += 1
-	} else {
-		history[item] = 1
-	}
+	AddToHistoryAt(history, item, time.Now())
 }
 
-func WriteHistoryToFile(history History, file *os.File) {
-	for historyItem, count := range history {
-		line := fmt.Sprintf("%s %d\n", historyItem, count)
-		_, err := file.WriteString(line)
-		mare.PanicIfErr(err)
-	}
+func AddToHistoryAt(history History, item string, when time.Time) {
+	AddToHistoryOnDevice(history, item, LocalDevice(), when)
 }
 
-func getItemAndCountFromLine(historyLine string) (string, int) {
-	trimmedHistoryLine := strings.TrimSpace(historyLine)
-	splitWords := strings.Split(trimmedHistoryLine, " ")
-	if len(splitWords) != 2 {
-		errorMessage := fmt.Sprintf("Unexpected line: %s", trimmedHistoryLine)
-		panic(errorMessage)
+func AddToHistoryOnDevice(history History, item, device string, when time.Time) {
+	entry := copyEntry(history[item])
+	entry.Count += 1
+	if entry.Devices == nil {
+		entry.Devices = make(map[string]int)
 	}
-	item := splitWords[0]
-	countString := splitWords[1]
-	count, err := strconv.ParseInt(countString, 10, 64)
-	countAsInt := int(count)
-	mare.PanicIfErr(err)
-	return item, countAsInt
+	entry.Devices[device] += 1
+	if when.After(entry.LastUsed) {
+		entry.LastUsed = when
+	}
+	entry.Recent = appendRecentUse(entry.Recent, when)
+	history[item] = entry
 }
 
-func GetHistoryFromFile(reader *bufio.Reader) History {
-	history := make(History)
-	for {
-		line, err := reader.ReadString('\n')
-		mare.PanicIfNotOfType(err, io.EOF)
-		if err != nil {
-			break
-		}
-		item, count := getItemAndCountFromLine(line)
-		history[item] = count
+func appendRecentUse(recent []time.Time, when time.Time) []time.Time {
+	recent = append(recent, when)
+	sort.Slice(recent, func(i, j int) bool {
+		return recent[i].Before(recent[j])
+	})
+	if len(recent) > maxRecentUses {
+		recent = recent[len(recent)-maxRecentUses:]
 	}
-	return history
+	return recent
 }
 
-func appendToCountMap(countToItemMap reverseHistory, count int, item string) {
-	itemListForCount, ok := countToItemMap[count]
-	if ok {
-		itemListForCount = append(itemListForCount, item)
-		sort.Strings(itemListForCount)
-		countToItemMap[count] = itemListForCount
-	} else {
-		countToItemMap[count] = []string{item}
-	}
+func WriteHistoryToFile(history History, file *os.File) {
+	err := Save(file, history)
+	mare.PanicIfErr(err)
 }
 
-func buildReverseMap(history History) (reverseHistory, []int) {
-	countToItemMap := make(reverseHistory)
-	countSet := make(intSet)
-	for item, count := range history {
-		addToSet(countSet, count)
-		appendToCountMap(countToItemMap, count, item)
-	}
-	counts := getSetAsSlice(countSet)
-	sort.Sort(sort.Reverse(sort.IntSlice(counts)))
-	return countToItemMap, counts
+func GetHistoryFromFile(reader *bufio.Reader) History {
+	history, err := Load(reader)
+	mare.PanicIfErr(err)
+	return history
 }
 
 func GetOrderedHistoryByCount(history History) []string {
-	reverseHistory, orderedCounts := buildReverseMap(history)
-	itemsOrderedByCount := make([]string, 0)
-	for _, count := range orderedCounts {
-		items := reverseHistory[count]
-		itemsOrderedByCount = append(itemsOrderedByCount, items...)
-	}
-	return itemsOrderedByCount
+	return Rank(history, Then(ByCount, Alphabetical))
 }
@@ -0,0 +1,501 @@
+package history
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	DefaultJournalThreshold = 64 * 1024
+
+	journalSuffix = ".journal"
+	journalIDSize = 8
+
+	RecordOp = "record"
+	PutOp    = "put"
+	ForgetOp = "forget"
+)
+
+// Event is a single change to a history as kept in a journal.
+type Event struct {
+	Op     string
+	Item   string
+	When   time.Time
+	Device string
+	Entry  Entry
+}
+
+type eventRecord struct {
+	Op     string  `json:"op"`
+	Item   string  `json:"item"`
+	When   int64   `json:"when,omitempty"`
+	Device string  `json:"device,omitempty"`
+	Entry  *record `json:"entry,omitempty"`
+}
+
+type journalHeader struct {
+	Journal string      `json:"journal"`
+	Key     *journalKey `json:"key,omitempty"`
+}
+
+// journalKey is how the key sealing the events of an encrypted journal is derived from the cipher
+// of the store.
+type journalKey struct {
+	KDF  byte   `json:"kdf"`
+	Salt []byte `json:"salt"`
+}
+
+// Journal keeps a history as a snapshot in a Store plus a journal of the changes made since the
+// snapshot was written. Changes are appended to the journal, which is folded into a new snapshot
+// once it grows past Threshold bytes. The snapshot names the journal it has folded in, so a crash
+// between writing the snapshot and starting a new journal never applies the same events twice.
+type Journal struct {
+	store     *Store
+	path      string
+	Threshold int64
+
+	// The key of an encrypted journal is derived once and kept for as long as the journal lasts.
+	mutex    sync.Mutex
+	sealerID string
+	sealer   *sealer
+}
+
+func NewJournal(store *Store) *Journal {
+	return &Journal{store: store, path: JournalPath(store.Path()), Threshold: DefaultJournalThreshold}
+}
+
+// JournalPath returns the path of the journal kept next to the snapshot at path.
+func JournalPath(path string) string {
+	return path + journalSuffix
+}
+
+func newJournalID() (string, error) {
+	id := make([]byte, journalIDSize)
+	_, err := io.ReadFull(rand.Reader, id)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
+
+func (e Event) toRecord() eventRecord {
+	r := eventRecord{Op: e.Op, Item: e.Item, When: toUnix(e.When), Device: e.Device}
+	if e.Op == PutOp {
+		entryRecord := toRecord("", e.Entry)
+		r.Entry = &entryRecord
+	}
+	return r
+}
+
+func (r eventRecord) event() Event {
+	e := Event{Op: r.Op, Item: r.Item, When: fromUnix(r.When), Device: r.Device}
+	if r.Entry != nil {
+		e.Entry = r.Entry.entry()
+	}
+	return e
+}
+
+func applyEvent(history History, event Event) {
+	switch event.Op {
+	case RecordOp:
+		AddToHistoryOnDevice(history, event.Item, event.Device, event.When)
+	case PutOp:
+		history[event.Item] = event.Entry
+	case ForgetOp:
+		delete(history, event.Item)
+	}
+}
+
+// sealerFor returns the sealer for the events of the journal with header h.
+func (j *Journal) sealerFor(h journalHeader) (*sealer, error) {
+	if j.store.cipher == nil {
+		return nil, ErrMissingKey
+	}
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	if j.sealer != nil && j.sealerID == h.Journal {
+		return j.sealer, nil
+	}
+	s, err := j.store.cipher.newSealer(h.Key.KDF, h.Key.Salt, []byte(h.Journal))
+	if err != nil {
+		return nil, err
+	}
+	j.sealerID, j.sealer = h.Journal, s
+	return s, nil
+}
+
+// Events of an encrypted store are sealed one by one with the key of the journal, under a fresh
+// nonce each.
+func (j *Journal) encodeEvent(h journalHeader, event Event) ([]byte, error) {
+	line, err := json.Marshal(event.toRecord())
+	if err != nil || j.store.cipher == nil {
+		return line, err
+	}
+	s, err := j.sealerFor(h)
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := s.seal(line)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(base64.StdEncoding.EncodeToString(sealed)), nil
+}
+
+// decodeEvent also reads events of journals without a key, which were sealed with the cipher of
+// the store on their own.
+func (j *Journal) decodeEvent(h journalHeader, line []byte) (Event, error) {
+	var r eventRecord
+	if !bytes.HasPrefix(line, []byte("{")) {
+		sealed, err := base64.StdEncoding.DecodeString(string(line))
+		if err != nil {
+			return Event{}, err
+		}
+		if j.store.cipher == nil {
+			return Event{}, ErrMissingKey
+		}
+		if h.Key == nil {
+			line, err = j.store.cipher.Open(sealed)
+		} else {
+			var s *sealer
+			s, err = j.sealerFor(h)
+			if err == nil {
+				line, err = s.open(sealed)
+			}
+		}
+		if err != nil {
+			return Event{}, err
+		}
+	}
+	err := json.Unmarshal(line, &r)
+	if err != nil {
+		return Event{}, err
+	}
+	if r.Op != RecordOp && r.Op != PutOp && r.Op != ForgetOp {
+		return Event{}, ErrUnexpectedLine
+	}
+	return r.event(), nil
+}
+
+// readJournal returns the journal ID and its events. A last line without a newline is the trace of
+// an interrupted append and is ignored.
+func (j *Journal) readJournal() (string, []Event, error) {
+	content, err := ioutil.ReadFile(j.path)
+	if os.IsNotExist(err) {
+		return "", nil, nil
+	} else if err != nil {
+		return "", nil, err
+	}
+	lines := bytes.Split(content, []byte("\n"))
+	lines = lines[:len(lines)-1]
+	if len(lines) == 0 {
+		return "", nil, nil
+	}
+
+	h, err := parseJournalHeader(lines[0])
+	if err != nil {
+		return "", nil, err
+	}
+	events := make([]Event, 0, len(lines)-1)
+	for index, line := range lines[1:] {
+		if len(line) == 0 {
+			continue
+		}
+		event, err := j.decodeEvent(h, line)
+		if err != nil {
+			parseError := &ParseError{Line: index + 2, Text: string(line), Err: err}
+			if j.store.OnParseError == nil {
+				return "", nil, parseError
+			}
+			j.store.OnParseError(parseError)
+			continue
+		}
+		events = append(events, event)
+	}
+	return h.Journal, events, nil
+}
+
+func parseJournalHeader(line []byte) (journalHeader, error) {
+	var h journalHeader
+	err := json.Unmarshal(line, &h)
+	if err != nil || h.Journal == "" || (h.Key != nil && len(h.Key.Salt) != saltSize) {
+		return journalHeader{}, &ParseError{Line: 1, Text: string(line), Err: ErrUnexpectedLine}
+	}
+	return h, nil
+}
+
+// readJournalHeader only reads the first line of the journal, returning an empty header if there
+// is no journal.
+func (j *Journal) readJournalHeader() (journalHeader, error) {
+	file, err := os.Open(j.path)
+	if os.IsNotExist(err) {
+		return journalHeader{}, nil
+	} else if err != nil {
+		return journalHeader{}, err
+	}
+	defer file.Close()
+
+	firstLine, err := bufio.NewReader(file).ReadBytes('\n')
+	if err == io.EOF {
+		return journalHeader{}, nil
+	} else if err != nil {
+		return journalHeader{}, err
+	}
+	return parseJournalHeader(firstLine)
+}
+
+// startJournal starts a new journal, with a fresh salt for its key if the store is encrypted.
+func (j *Journal) startJournal() (journalHeader, error) {
+	id, err := newJournalID()
+	if err != nil {
+		return journalHeader{}, err
+	}
+	h := journalHeader{Journal: id}
+	if j.store.cipher != nil {
+		kdf := j.store.cipher.kdf()
+		salt, err := newSalt(kdf)
+		if err != nil {
+			return journalHeader{}, err
+		}
+		h.Key = &journalKey{KDF: kdf, Salt: salt}
+	}
+	var buffer bytes.Buffer
+	err = writeJSONLine(&buffer, h)
+	if err != nil {
+		return journalHeader{}, err
+	}
+	return h, replaceFile(j.path, buffer.Bytes())
+}
+
+// load returns the snapshot with the journal replayed over it, along with the journal ID.
+func (j *Journal) load() (History, string, error) {
+	history, snapshotHeader, err := j.store.readWithHeader()
+	if err != nil {
+		return nil, "", err
+	}
+	id, events, err := j.readJournal()
+	if err != nil {
+		return nil, "", err
+	}
+	if id != snapshotHeader.Journal {
+		for _, event := range events {
+			applyEvent(history, event)
+		}
+	}
+	return history, id, nil
+}
+
+// writeSnapshot writes history as the new snapshot, marking the events of the journal with the
+// given ID as folded in, and starts a new journal.
+func (j *Journal) writeSnapshot(history History, id string) error {
+	h := newHeader()
+	h.Journal = id
+	err := j.store.writeWithHeader(history, h)
+	if err != nil {
+		return err
+	}
+	_, err = j.startJournal()
+	return err
+}
+
+func (j *Journal) fold() error {
+	history, id, err := j.load()
+	if err != nil {
+		return err
+	}
+	return j.writeSnapshot(history, id)
+}
+
+func (j *Journal) Load() (History, error) {
+	lockFile, err := j.store.lock(syscall.LOCK_SH)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock(lockFile)
+	history, _, err := j.load()
+	return history, err
+}
+
+// Events returns the changes recorded since the journal was last folded into the snapshot.
+func (j *Journal) Events() ([]Event, error) {
+	lockFile, err := j.store.lock(syscall.LOCK_SH)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock(lockFile)
+	_, events, err := j.readJournal()
+	return events, err
+}
+
+// dropTornTail truncates the journal after its last complete line, getting rid of what an
+// interrupted append left behind.
+func dropTornTail(file *os.File) error {
+	info, err := file.Stat()
+	if err != nil || info.Size() == 0 {
+		return err
+	}
+	content := make([]byte, info.Size())
+	_, err = file.ReadAt(content, 0)
+	if err != nil {
+		return err
+	}
+	completeSize := bytes.LastIndexByte(content, '\n') + 1
+	if completeSize == len(content) {
+		return nil
+	}
+	return file.Truncate(int64(completeSize))
+}
+
+func (j *Journal) appendEvent(event Event) error {
+	lockFile, err := j.store.lock(syscall.LOCK_EX)
+	if err != nil {
+		return err
+	}
+	defer unlock(lockFile)
+
+	// A journal the snapshot has folded in is left behind by a crash right after writing the
+	// snapshot, and has to be replaced before appending to it.
+	h, err := j.readJournalHeader()
+	if err != nil {
+		return err
+	}
+	snapshotHeader, err := j.store.readHeader()
+	if err != nil {
+		return err
+	}
+	if h.Journal == "" || h.Journal == snapshotHeader.Journal {
+		h, err = j.startJournal()
+		if err != nil {
+			return err
+		}
+	} else if j.store.cipher != nil && h.Key == nil {
+		// Journals without a key are folded away rather than appended to, so a key is only
+		// derived once per journal.
+		err = j.fold()
+		if err != nil {
+			return err
+		}
+		h, err = j.readJournalHeader()
+		if err != nil {
+			return err
+		}
+	}
+
+	line, err := j.encodeEvent(h, event)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(j.path, os.O_RDWR|os.O_APPEND, storeFileMode)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	err = dropTornTail(file)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(append(line, '\n'))
+	if err != nil {
+		return err
+	}
+	err = file.Sync()
+	if err != nil {
+		return err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	if j.Threshold > 0 && info.Size() >= j.Threshold {
+		return j.fold()
+	}
+	return nil
+}
+
+func (j *Journal) Record(item string, when time.Time) error {
+	return j.appendEvent(Event{Op: RecordOp, Item: item, When: when, Device: LocalDevice()})
+}
+
+func (j *Journal) Put(item string, entry Entry) error {
+	return j.appendEvent(Event{Op: PutOp, Item: item, Entry: entry})
+}
+
+func (j *Journal) Forget(item string) error {
+	return j.appendEvent(Event{Op: ForgetOp, Item: item})
+}
+
+// Update lets fn modify the history with the journal replayed and writes the result as a new
+// snapshot.
+func (j *Journal) Update(fn func(History) error) error {
+	lockFile, err := j.store.lock(syscall.LOCK_EX)
+	if err != nil {
+		return err
+	}
+	defer unlock(lockFile)
+
+	history, id, err := j.load()
+	if err != nil {
+		return err
+	}
+	err = fn(history)
+	if err != nil {
+		return err
+	}
+	return j.writeSnapshot(history, id)
+}
+
+func (j *Journal) Replace(history History) error {
+	return j.Update(func(stored History) error {
+		for item := range stored {
+			delete(stored, item)
+		}
+		for item, entry := range history {
+			stored[item] = entry
+		}
+		return nil
+	})
+}
+
+// Rekey folds the journal into a new snapshot encrypted with c, starting a new journal sealed with
+// c as well.
+func (j *Journal) Rekey(c *Cipher) error {
+	lockFile, err := j.store.lock(syscall.LOCK_EX)
+	if err != nil {
+		return err
+	}
+	defer unlock(lockFile)
+
+	history, id, err := j.load()
+	if err != nil {
+		return err
+	}
+	j.mutex.Lock()
+	j.store.cipher, j.sealerID, j.sealer = c, "", nil
+	j.mutex.Unlock()
+	return j.writeSnapshot(history, id)
+}
+
+// Compact folds the journal into a new snapshot.
+func (j *Journal) Compact() error {
+	lockFile, err := j.store.lock(syscall.LOCK_EX)
+	if err != nil {
+		return err
+	}
+	defer unlock(lockFile)
+	return j.fold()
+}
+
+func (j *Journal) Close() error {
+	return nil
+}
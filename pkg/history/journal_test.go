@@ -0,0 +1,145 @@
+package history
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newEncryptedJournal(t *testing.T, c *Cipher) *Journal {
+	t.Helper()
+	return NewJournal(NewEncryptedStore(filepath.Join(t.TempDir(), "history"), c))
+}
+
+func TestEncryptedJournalRoundTrip(t *testing.T) {
+	journal := newEncryptedJournal(t, NewPassphraseCipher([]byte("secret")))
+	now := time.Unix(1600000000, 0)
+	for _, item := range []string{"a", "b", "a"} {
+		err := journal.Record(item, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	content, err := ioutil.ReadFile(journal.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := bytes.Split(bytes.TrimSpace(content), []byte("\n"))
+	h, err := parseJournalHeader(lines[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Key == nil || h.Key.KDF != kdfScrypt {
+		t.Fatalf("Expected a key derivation in the journal header, got %s", lines[0])
+	}
+	for _, line := range lines[1:] {
+		if bytes.Contains(line, []byte(`"item"`)) {
+			t.Errorf("Expected sealed events, got %s", line)
+		}
+	}
+
+	history, err := NewJournal(NewEncryptedStore(journal.store.Path(), NewPassphraseCipher([]byte("secret")))).Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if history["a"].Count != 2 || history["b"].Count != 1 {
+		t.Errorf("Unexpected history %v", history)
+	}
+	_, err = NewJournal(NewEncryptedStore(journal.store.Path(), NewPassphraseCipher([]byte("wrong")))).Load()
+	if err == nil {
+		t.Error("Expected loading with the wrong passphrase to fail")
+	}
+}
+
+func TestEncryptedSnapshotHeaderWithoutKey(t *testing.T) {
+	journal := newEncryptedJournal(t, NewPassphraseCipher([]byte("secret")))
+	err := journal.Record("a", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = journal.Compact()
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, _, err := journal.readJournal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h, err := NewStore(journal.store.Path()).readHeader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Journal == "" || h.Journal == id {
+		t.Errorf("Expected the snapshot to name the folded journal, not %q, got %q", id, h.Journal)
+	}
+}
+
+func TestJournalWithoutKeyIsFolded(t *testing.T) {
+	c := NewPassphraseCipher([]byte("secret"))
+	journal := newEncryptedJournal(t, c)
+	line, err := json.Marshal(Event{Op: RecordOp, Item: "old", When: time.Now()}.toRecord())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := c.Seal(line)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content := `{"journal":"0011223344556677"}` + "\n" + base64.StdEncoding.EncodeToString(sealed) + "\n"
+	err = ioutil.WriteFile(journal.path, []byte(content), storeFileMode)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = journal.Record("new", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := journal.readJournalHeader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Key == nil {
+		t.Error("Expected a journal with a key after appending")
+	}
+	history, err := journal.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if history["old"].Count != 1 || history["new"].Count != 1 {
+		t.Errorf("Unexpected history %v", history)
+	}
+	_, err = os.Stat(journal.store.Path())
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDecryptJournal(t *testing.T) {
+	journal := newEncryptedJournal(t, NewPassphraseCipher([]byte("secret")))
+	for _, item := range []string{"a", "b"} {
+		err := journal.Record(item, time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := Rekey(journal, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	history, err := NewJournal(NewStore(journal.store.Path())).Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if history["a"].Count != 1 || history["b"].Count != 1 {
+		t.Errorf("Unexpected history %v", history)
+	}
+}
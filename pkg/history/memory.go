@@ -0,0 +1,54 @@
+package history
+
+import (
+	"sync"
+	"time"
+)
+
+// MemoryBackend keeps a History in memory only, which is mostly useful for tests.
+type MemoryBackend struct {
+	mutex   sync.Mutex
+	history History
+}
+
+func NewMemoryBackend(initial History) *MemoryBackend {
+	return &MemoryBackend{history: copyHistory(initial)}
+}
+
+func (m *MemoryBackend) Load() (History, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return copyHistory(m.history), nil
+}
+
+func (m *MemoryBackend) Record(item string, when time.Time) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	AddToHistoryAt(m.history, item, when)
+	return nil
+}
+
+func (m *MemoryBackend) Put(item string, entry Entry) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.history[item] = copyEntry(entry)
+	return nil
+}
+
+func (m *MemoryBackend) Forget(item string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	delete(m.history, item)
+	return nil
+}
+
+func (m *MemoryBackend) Replace(history History) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.history = copyHistory(history)
+	return nil
+}
+
+func (m *MemoryBackend) Close() error {
+	return nil
+}
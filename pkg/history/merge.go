@@ -0,0 +1,165 @@
+package history
+
+import (
+	"os"
+	"time"
+)
+
+const deviceEnvVar = "STUFF_HISTORY_DEVICE"
+
+// LocalDevice names the device uses are recorded on, which is the host name unless overridden
+// through the environment.
+func LocalDevice() string {
+	device := os.Getenv(deviceEnvVar)
+	if device != "" {
+		return device
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		return ""
+	}
+	return hostname
+}
+
+func attributedCount(entry Entry) int {
+	count := 0
+	for _, deviceCount := range entry.Devices {
+		count += deviceCount
+	}
+	return count
+}
+
+func unattributedCount(entry Entry) int {
+	count := entry.Count - attributedCount(entry)
+	if count < 0 {
+		return 0
+	}
+	return count
+}
+
+func maxTime(left, right time.Time) time.Time {
+	if right.After(left) {
+		return right
+	}
+	return left
+}
+
+func mergeRecentUses(left, right []time.Time) []time.Time {
+	seen := make(map[int64]bool)
+	merged := make([]time.Time, 0, len(left)+len(right))
+	for _, used := range append(append([]time.Time(nil), left...), right...) {
+		if seen[used.UnixNano()] {
+			continue
+		}
+		seen[used.UnixNano()] = true
+		merged = appendRecentUse(merged, used)
+	}
+	return merged
+}
+
+// mergeEntries keeps the largest count seen for every device instead of adding counts up, so
+// merging the same copies again does not count any use twice. Counts not attributed to any device
+// are treated as coming from one and the same device, so their largest one is kept as well.
+func mergeEntries(left, right Entry) Entry {
+	merged := Entry{
+		LastUsed:  maxTime(left.LastUsed, right.LastUsed),
+		Recent:    mergeRecentUses(left.Recent, right.Recent),
+		DecayedAt: maxTime(left.DecayedAt, right.DecayedAt),
+		Devices:   make(map[string]int),
+	}
+	for _, entry := range []Entry{left, right} {
+		for device, count := range entry.Devices {
+			if count > merged.Devices[device] {
+				merged.Devices[device] = count
+			}
+		}
+	}
+	unattributed := unattributedCount(left)
+	if unattributedCount(right) > unattributed {
+		unattributed = unattributedCount(right)
+	}
+	merged.Count = unattributed + attributedCount(merged)
+	if len(merged.Devices) == 0 {
+		merged.Devices = nil
+	}
+	return merged
+}
+
+// Attribute returns a copy of history with the counts that are not attributed to any device, such
+// as those of histories written before devices were tracked, attributed to device. Attributing the
+// copies of a history to different devices before merging them adds up their uses instead of
+// keeping the largest count.
+func Attribute(history History, device string) History {
+	attributed := copyHistory(history)
+	for item, entry := range attributed {
+		unattributed := unattributedCount(entry)
+		if unattributed == 0 {
+			continue
+		}
+		if entry.Devices == nil {
+			entry.Devices = make(map[string]int)
+		}
+		entry.Devices[device] += unattributed
+		attributed[item] = entry
+	}
+	return attributed
+}
+
+// Merge combines histories item by item. The result does not depend on the order of the
+// histories and merging a history that has already been merged changes nothing.
+func Merge(histories ...History) History {
+	return MergeHalving(0, histories...)
+}
+
+// latestDecay returns the latest time any copy of each item was halved.
+func latestDecay(histories []History) map[string]time.Time {
+	latest := make(map[string]time.Time)
+	for _, history := range histories {
+		for item, entry := range history {
+			latest[item] = maxTime(latest[item], entry.DecayedAt)
+		}
+	}
+	return latest
+}
+
+// MergeHalving merges histories like Merge, for histories compacted with a HalveEvery of
+// halveEvery. Copies of an item halved less recently than others are first halved as many times
+// as they missed out on, so that merging them does not bring back the counts halving got rid of.
+// Copies that were never halved are merged as they are.
+func MergeHalving(halveEvery time.Duration, histories ...History) History {
+	var latest map[string]time.Time
+	if halveEvery > 0 {
+		latest = latestDecay(histories)
+	}
+	merged := make(History)
+	for _, history := range histories {
+		for item, entry := range history {
+			if halveEvery > 0 && !entry.DecayedAt.IsZero() {
+				entry = halveEntry(entry, halveEvery, latest[item])
+			}
+			existing, ok := merged[item]
+			if ok {
+				merged[item] = mergeEntries(existing, entry)
+			} else {
+				merged[item] = mergeEntries(Entry{}, entry)
+			}
+		}
+	}
+	return merged
+}
+
+// MergeInto merges histories into the history kept in backend.
+func MergeInto(backend Backend, histories ...History) error {
+	return MergeIntoHalving(backend, 0, histories...)
+}
+
+// MergeIntoHalving merges histories into the history kept in backend like MergeHalving.
+func MergeIntoHalving(backend Backend, halveEvery time.Duration, histories ...History) error {
+	return update(backend, func(stored History) error {
+		merged := MergeHalving(halveEvery, append([]History{stored}, histories...)...)
+		for item, entry := range merged {
+			stored[item] = entry
+		}
+		return nil
+	})
+}
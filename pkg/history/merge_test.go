@@ -0,0 +1,87 @@
+package history
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testHalveEvery = 24 * time.Hour
+
+var mergeStart = time.Unix(1600000000, 0)
+
+func TestMergeIsIdempotent(t *testing.T) {
+	left := History{"a": {Count: 3, LastUsed: mergeStart, Devices: map[string]int{"laptop": 3}}}
+	right := History{
+		"a": {Count: 2, LastUsed: mergeStart.Add(time.Hour), Devices: map[string]int{"laptop": 1, "phone": 1}},
+		"b": {Count: 1, LastUsed: mergeStart},
+	}
+	merged := Merge(left, right)
+	if merged["a"].Count != 4 || merged["b"].Count != 1 {
+		t.Errorf("Unexpected merge %v", merged)
+	}
+	if again := Merge(merged, left, right); !reflect.DeepEqual(again, merged) {
+		t.Errorf("Expected merging again to change nothing, got %v", again)
+	}
+	if reversed := Merge(right, left); !reflect.DeepEqual(reversed, merged) {
+		t.Errorf("Expected the order not to matter, got %v", reversed)
+	}
+}
+
+func TestMergeHalvingKeepsCountsHalved(t *testing.T) {
+	unhalved := History{"a": {Count: 8, LastUsed: mergeStart, DecayedAt: mergeStart,
+		Devices: map[string]int{"laptop": 8}}}
+	halved := ApplyRetention(unhalved, RetentionPolicy{HalveEvery: testHalveEvery}, mergeStart.Add(2*testHalveEvery))
+	if halved["a"].Count != 2 {
+		t.Fatalf("Expected halving twice, got %v", halved)
+	}
+
+	if merged := Merge(unhalved, halved); merged["a"].Count != 8 {
+		t.Errorf("Expected a plain merge to restore the count, got %v", merged)
+	}
+	merged := MergeHalving(testHalveEvery, unhalved, halved)
+	if merged["a"].Count != 2 || !merged["a"].DecayedAt.Equal(halved["a"].DecayedAt) {
+		t.Errorf("Expected the count to stay halved, got %v", merged)
+	}
+	if reversed := MergeHalving(testHalveEvery, halved, unhalved); !reflect.DeepEqual(reversed, merged) {
+		t.Errorf("Expected the order not to matter, got %v", reversed)
+	}
+	if again := MergeHalving(testHalveEvery, merged, unhalved, halved); !reflect.DeepEqual(again, merged) {
+		t.Errorf("Expected merging again to change nothing, got %v", again)
+	}
+}
+
+func TestMergeHalvingKeepsNewUses(t *testing.T) {
+	halved := History{"a": {Count: 2, LastUsed: mergeStart, DecayedAt: mergeStart.Add(testHalveEvery),
+		Devices: map[string]int{"laptop": 2}}}
+	used := History{"a": {Count: 5, LastUsed: mergeStart.Add(2 * testHalveEvery), DecayedAt: mergeStart.Add(testHalveEvery),
+		Devices: map[string]int{"laptop": 2, "phone": 3}}}
+	merged := MergeHalving(testHalveEvery, halved, used)
+	if merged["a"].Count != 5 {
+		t.Errorf("Expected uses since the last halving to count in full, got %v", merged)
+	}
+}
+
+func TestMergeAttributedLegacyHistories(t *testing.T) {
+	var histories []History
+	for i, count := range []string{"5", "7", "2"} {
+		legacy, err := Load(strings.NewReader("work/My Bank.gpg " + count + "\nmail 1\n"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		histories = append(histories, Attribute(legacy, fmt.Sprintf("laptop-%d", i)))
+	}
+	if merged := Merge(histories...); merged["work/My Bank.gpg"].Count != 14 || merged["mail"].Count != 3 {
+		t.Errorf("Expected the counts of the copies to be summed, got %v", merged)
+	}
+	if merged := Merge(histories...); !reflect.DeepEqual(Merge(merged, histories[1]), merged) {
+		t.Error("Expected merging a copy again to change nothing")
+	}
+
+	attributed := Attribute(History{"a": {Count: 5, Devices: map[string]int{"phone": 2}}}, "laptop")
+	if devices := attributed["a"].Devices; attributed["a"].Count != 5 || devices["phone"] != 2 || devices["laptop"] != 3 {
+		t.Errorf("Expected only the unattributed uses to be attributed, got %v", attributed)
+	}
+}
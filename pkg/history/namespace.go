@@ -0,0 +1,187 @@
+package history
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// Items of a namespace are stored under the namespace name followed by this separator, items of
+// the root namespace, which is also where histories without namespaces live, are stored as is.
+const (
+	RootNamespace      = ""
+	namespaceSeparator = "\x1f"
+)
+
+// Namespaced exposes a single namespace of a backend as a backend of its own, so several separate
+// rankings can share one store.
+type Namespaced struct {
+	backend Backend
+	name    string
+	// prefix is the namespace keys are stored under in backend, the root one when the backend is a
+	// client that only ever sees its own namespace.
+	prefix string
+}
+
+// Namespace exposes the namespace name of backend. The history service does the namespace
+// filtering for clients, as the history a client loads has no namespaces left in it.
+func Namespace(backend Backend, name string) *Namespaced {
+	client, ok := backend.(*Client)
+	if ok {
+		return &Namespaced{backend: client.WithNamespace(name), name: name, prefix: RootNamespace}
+	}
+	return &Namespaced{backend: backend, name: name, prefix: name}
+}
+
+func namespacedKey(namespace, item string) string {
+	if namespace == RootNamespace {
+		return item
+	}
+	return namespace + namespaceSeparator + item
+}
+
+func splitKey(key string) (string, string) {
+	separatorIndex := strings.Index(key, namespaceSeparator)
+	if separatorIndex < 0 {
+		return RootNamespace, key
+	}
+	return key[:separatorIndex], key[separatorIndex+len(namespaceSeparator):]
+}
+
+func (n *Namespaced) key(item string) string {
+	return namespacedKey(n.prefix, item)
+}
+
+func (n *Namespaced) Name() string {
+	return n.name
+}
+
+func extractNamespace(history History, namespace string) History {
+	extracted := make(History)
+	for key, entry := range history {
+		keyNamespace, item := splitKey(key)
+		if keyNamespace == namespace {
+			extracted[item] = entry
+		}
+	}
+	return extracted
+}
+
+func (n *Namespaced) Load() (History, error) {
+	history, err := n.backend.Load()
+	if err != nil {
+		return nil, err
+	}
+	return extractNamespace(history, n.prefix), nil
+}
+
+func (n *Namespaced) Record(item string, when time.Time) error {
+	return n.backend.Record(n.key(item), when)
+}
+
+func (n *Namespaced) Put(item string, entry Entry) error {
+	return n.backend.Put(n.key(item), entry)
+}
+
+func (n *Namespaced) Forget(item string) error {
+	return n.backend.Forget(n.key(item))
+}
+
+func (n *Namespaced) replaceIn(stored History, history History) {
+	for key := range stored {
+		keyNamespace, _ := splitKey(key)
+		if keyNamespace == n.prefix {
+			delete(stored, key)
+		}
+	}
+	for item, entry := range history {
+		stored[n.key(item)] = entry
+	}
+}
+
+// Update lets fn modify the items of this namespace, leaving the other namespaces alone.
+func (n *Namespaced) Update(fn func(History) error) error {
+	return update(n.backend, func(stored History) error {
+		history := extractNamespace(stored, n.prefix)
+		err := fn(history)
+		if err != nil {
+			return err
+		}
+		n.replaceIn(stored, history)
+		return nil
+	})
+}
+
+// Replace only replaces the items of this namespace.
+func (n *Namespaced) Replace(history History) error {
+	return update(n.backend, func(stored History) error {
+		n.replaceIn(stored, history)
+		return nil
+	})
+}
+
+func (n *Namespaced) Close() error {
+	return n.backend.Close()
+}
+
+func Namespaces(backend Backend) ([]string, error) {
+	history, err := backend.Load()
+	if err != nil {
+		return nil, err
+	}
+	namespaceSet := make(map[string]bool)
+	for key := range history {
+		namespace, _ := splitKey(key)
+		namespaceSet[namespace] = true
+	}
+	namespaces := make([]string, 0, len(namespaceSet))
+	for namespace := range namespaceSet {
+		namespaces = append(namespaces, namespace)
+	}
+	sort.Strings(namespaces)
+	return namespaces, nil
+}
+
+type Scorer func(Entry) float64
+
+func CountScorer(entry Entry) float64 {
+	return float64(entry.Count)
+}
+
+func FrecencyScorer(now time.Time, halfLife time.Duration) Scorer {
+	return func(entry Entry) float64 {
+		return FrecencyScore(entry, now, halfLife)
+	}
+}
+
+type WeightedNamespace struct {
+	Namespace string
+	Weight    float64
+}
+
+// Blend orders the items of several namespaces by the weighted sum of their scores in each
+// namespace, breaking ties alphabetically.
+func Blend(backend Backend, namespaces []WeightedNamespace, score Scorer) ([]string, error) {
+	history, err := backend.Load()
+	if err != nil {
+		return nil, err
+	}
+	blended := make(map[string]float64)
+	for _, weighted := range namespaces {
+		for item, entry := range extractNamespace(history, weighted.Namespace) {
+			blended[item] += weighted.Weight * score(entry)
+		}
+	}
+	items := make([]string, 0, len(blended))
+	for item := range blended {
+		items = append(items, item)
+	}
+	sort.Slice(items, func(i, j int) bool {
+		left, right := items[i], items[j]
+		if blended[left] != blended[right] {
+			return blended[left] > blended[right]
+		}
+		return left < right
+	})
+	return items, nil
+}
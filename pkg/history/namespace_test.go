@@ -0,0 +1,119 @@
+package history
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNamespacesStaySeparate(t *testing.T) {
+	store := NewStore(filepath.Join(t.TempDir(), "history"))
+	root, team := Namespace(store, RootNamespace), Namespace(store, "team")
+	for _, recorded := range []struct {
+		namespace *Namespaced
+		item      string
+	}{
+		{root, "web/site"},
+		{root, "web/site"},
+		{team, "web/site"},
+		{team, "vpn"},
+	} {
+		err := recorded.namespace.Record(recorded.item, time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rootHistory, err := root.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rootHistory) != 1 || rootHistory["web/site"].Count != 2 {
+		t.Errorf("Unexpected root history %v", rootHistory)
+	}
+	teamHistory, err := team.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(teamHistory) != 2 || teamHistory["web/site"].Count != 1 || teamHistory["vpn"].Count != 1 {
+		t.Errorf("Unexpected team history %v", teamHistory)
+	}
+	namespaces, err := Namespaces(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(namespaces, []string{RootNamespace, "team"}) {
+		t.Errorf("Unexpected namespaces %v", namespaces)
+	}
+
+	err = team.Forget("web/site")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rootHistory, err = root.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rootHistory["web/site"].Count != 2 {
+		t.Errorf("Expected forgetting in one namespace to leave the other alone, got %v", rootHistory)
+	}
+}
+
+func TestNamespacedReplace(t *testing.T) {
+	store := NewStore(filepath.Join(t.TempDir(), "history"))
+	err := store.Replace(History{
+		"web/site":                           {Count: 2},
+		"team" + namespaceSeparator + "vpn":  {Count: 3},
+		"other" + namespaceSeparator + "vpn": {Count: 4},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = Namespace(store, "team").Replace(History{"mail": {Count: 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := History{
+		"web/site":                           {Count: 2},
+		"team" + namespaceSeparator + "mail": {Count: 1},
+		"other" + namespaceSeparator + "vpn": {Count: 4},
+	}
+	if !reflect.DeepEqual(stored, expected) {
+		t.Errorf("Expected %v, got %v", expected, stored)
+	}
+}
+
+func TestBlend(t *testing.T) {
+	backend := NewMemoryBackend(History{
+		"a":                                  {Count: 4},
+		"b":                                  {Count: 1},
+		"team" + namespaceSeparator + "b":    {Count: 2},
+		"team" + namespaceSeparator + "c":    {Count: 3},
+		"team" + namespaceSeparator + "d":    {Count: 4},
+		"ignored" + namespaceSeparator + "e": {Count: 100},
+	})
+	blended, err := Blend(backend, []WeightedNamespace{{RootNamespace, 1}, {"team", 0.5}}, CountScorer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a scores 4, b 1 + 0.5 * 2 = 2 and ties with d, c 1.5.
+	expected := []string{"a", "b", "d", "c"}
+	if !reflect.DeepEqual(blended, expected) {
+		t.Errorf("Expected %v, got %v", expected, blended)
+	}
+
+	blended, err = Blend(backend, []WeightedNamespace{{RootNamespace, 1}, {"team", 2}}, CountScorer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = []string{"d", "c", "b", "a"}
+	if !reflect.DeepEqual(blended, expected) {
+		t.Errorf("Expected the weights to reorder items to %v, got %v", expected, blended)
+	}
+}
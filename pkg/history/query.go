@@ -0,0 +1,142 @@
+package history
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+const (
+	matchPoints      = 1.0
+	boundaryBonus    = 2.0
+	consecutiveBonus = 1.5
+	gapPenalty       = 0.1
+	// usageWeight dampens usage, so that it decides between similar matches but a few uses do not
+	// put a poor match ahead of a much better one.
+	usageWeight = 0.25
+)
+
+type Match struct {
+	Item string
+	// MatchScore is how well the item matches the query, Usage is the usage score of the item and
+	// Score combines the two.
+	MatchScore float64
+	Usage      float64
+	Score      float64
+}
+
+func isBoundary(runes []rune, index int) bool {
+	if index == 0 {
+		return true
+	}
+	previous := runes[index-1]
+	if !unicode.IsLetter(previous) && !unicode.IsDigit(previous) {
+		return true
+	}
+	return unicode.IsLower(previous) && unicode.IsUpper(runes[index])
+}
+
+func charPoints(runes []rune, index int) float64 {
+	if isBoundary(runes, index) {
+		return matchPoints + boundaryBonus
+	}
+	return matchPoints
+}
+
+// FuzzyScore scores how well query matches candidate as a case-insensitive subsequence. Matches at
+// word boundaries and runs of consecutive characters score higher, gaps between matched characters
+// score lower. The second return value is false if query is not a subsequence of candidate.
+func FuzzyScore(candidate, query string) (float64, bool) {
+	queryRunes := []rune(strings.ToLower(query))
+	if len(queryRunes) == 0 {
+		return 0, true
+	}
+	candidateRunes := []rune(candidate)
+	lowerRunes := []rune(strings.ToLower(candidate))
+	if len(lowerRunes) != len(candidateRunes) {
+		candidateRunes = lowerRunes
+	}
+
+	negativeInfinity := math.Inf(-1)
+	previous := make([]float64, len(lowerRunes))
+	current := make([]float64, len(lowerRunes))
+	for j := range previous {
+		previous[j] = negativeInfinity
+	}
+
+	for i, queryRune := range queryRunes {
+		// bestBefore tracks the best score of the previous row adjusted for the gap to column j.
+		bestBefore := negativeInfinity
+		for j, candidateRune := range lowerRunes {
+			if j > 0 && previous[j-1] != negativeInfinity {
+				bestBefore = math.Max(bestBefore, previous[j-1]+gapPenalty*float64(j-1))
+			}
+			current[j] = negativeInfinity
+			if candidateRune != queryRune {
+				continue
+			}
+			points := charPoints(candidateRunes, j)
+			if i == 0 {
+				current[j] = points - gapPenalty*float64(j)
+				continue
+			}
+			if j == 0 {
+				continue
+			}
+			best := negativeInfinity
+			if previous[j-1] != negativeInfinity {
+				best = previous[j-1] + consecutiveBonus
+			}
+			if bestBefore != negativeInfinity {
+				best = math.Max(best, bestBefore-gapPenalty*float64(j-1))
+			}
+			if best != negativeInfinity {
+				current[j] = best + points
+			}
+		}
+		previous, current = current, previous
+	}
+
+	score := negativeInfinity
+	for _, columnScore := range previous {
+		score = math.Max(score, columnScore)
+	}
+	if score == negativeInfinity {
+		return 0, false
+	}
+	return score, true
+}
+
+// Query returns the candidates matching query, ordered by their match score weighted by how much
+// they were used according to usage. Candidates that are not in history have no usage and are
+// ordered by their match score alone.
+func Query(candidates []string, query string, history History, usage Scorer) []Match {
+	matches := make([]Match, 0)
+	for _, candidate := range candidates {
+		matchScore, ok := FuzzyScore(candidate, query)
+		if !ok {
+			continue
+		}
+		usageScore := 0.0
+		entry, inHistory := history[candidate]
+		if inHistory {
+			usageScore = usage(entry)
+		}
+		// Shift match scores to be positive so that usage can only improve a match.
+		combined := (1 + math.Max(matchScore, 0)) * (1 + usageWeight*math.Log1p(math.Max(usageScore, 0)))
+		matches = append(matches, Match{
+			Item:       candidate,
+			MatchScore: matchScore,
+			Usage:      usageScore,
+			Score:      combined,
+		})
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].Score != matches[j].Score {
+			return matches[i].Score > matches[j].Score
+		}
+		return matches[i].Item < matches[j].Item
+	})
+	return matches
+}
@@ -0,0 +1,97 @@
+package history
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func expectScore(t *testing.T, candidate, query string, expected float64) {
+	t.Helper()
+	score, ok := FuzzyScore(candidate, query)
+	if !ok {
+		t.Fatalf("Expected %s to match %s", query, candidate)
+	}
+	if math.Abs(score-expected) > 1e-9 {
+		t.Errorf("Expected %s to score %f against %s, got %f", query, expected, candidate, score)
+	}
+}
+
+func matchedItems(matches []Match) []string {
+	items := make([]string, 0, len(matches))
+	for _, match := range matches {
+		items = append(items, match.Item)
+	}
+	return items
+}
+
+func TestFuzzyScoreNoMatch(t *testing.T) {
+	for _, query := range []string{"xyz", "etis", "web/sites"} {
+		_, ok := FuzzyScore("web/site", query)
+		if ok {
+			t.Errorf("Expected %s not to match", query)
+		}
+	}
+	matches := Query([]string{"web/site", "mail"}, "xyz", History{}, CountScorer)
+	if len(matches) != 0 {
+		t.Errorf("Expected no matches, got %v", matches)
+	}
+}
+
+func TestQueryEmpty(t *testing.T) {
+	expectScore(t, "web/site", "", 0)
+	history := History{"mail": {Count: 3}, "web/site": {Count: 1}}
+	matches := Query([]string{"web/site", "bank", "mail"}, "", history, CountScorer)
+	if items := matchedItems(matches); !reflect.DeepEqual(items, []string{"mail", "web/site", "bank"}) {
+		t.Errorf("Expected an empty query to order every candidate by usage, got %v", items)
+	}
+}
+
+func TestFuzzyScoreBoundaries(t *testing.T) {
+	// Both characters start a word in web/site, only the first does in wrists.
+	boundary, _ := FuzzyScore("web/site", "ws")
+	scattered, _ := FuzzyScore("wrists", "ws")
+	if boundary <= scattered {
+		t.Errorf("Expected the word boundary match (%f) to beat the scattered one (%f)", boundary, scattered)
+	}
+	camel, _ := FuzzyScore("myBank", "b")
+	inner, _ := FuzzyScore("mybank", "b")
+	if camel <= inner {
+		t.Errorf("Expected a camel case boundary (%f) to beat an inner match (%f)", camel, inner)
+	}
+	expectScore(t, "WEB/Site", "ws", 5.7)
+}
+
+func TestFuzzyScoreConsecutiveAndGaps(t *testing.T) {
+	// a starts the candidate, every following character either continues the run or pays for the
+	// characters skipped since the previous match.
+	expectScore(t, "abcxx", "abc", 3+2*(matchPoints+consecutiveBonus))
+	expectScore(t, "axbxc", "abc", 3+2*(matchPoints-gapPenalty))
+	expectScore(t, "axc", "ac", 3+matchPoints-gapPenalty)
+	expectScore(t, "axxxc", "ac", 3+matchPoints-3*gapPenalty)
+	// Characters skipped before the first match count as a gap too.
+	expectScore(t, "xxb", "b", matchPoints-2*gapPenalty)
+}
+
+func TestQueryUsage(t *testing.T) {
+	candidates := []string{"web/shop", "web/site", "sxixtxe"}
+	history := History{"web/site": {Count: 2}}
+	matches := Query(candidates, "ws", history, CountScorer)
+	if items := matchedItems(matches); !reflect.DeepEqual(items, []string{"web/site", "web/shop"}) {
+		t.Errorf("Expected usage to break the tie between equal matches, got %v", items)
+	}
+	if matches[0].MatchScore != matches[1].MatchScore || matches[0].Usage != 2 || matches[1].Usage != 0 {
+		t.Errorf("Unexpected matches %v", matches)
+	}
+
+	history = History{"sxixtxe": {Count: 3}}
+	matches = Query(candidates, "site", history, CountScorer)
+	if items := matchedItems(matches); !reflect.DeepEqual(items, []string{"web/site", "sxixtxe"}) {
+		t.Errorf("Expected a few uses not to outrank a clearly better match, got %v", items)
+	}
+	history = History{"sxixtxe": {Count: 100}}
+	matches = Query(candidates, "site", history, CountScorer)
+	if items := matchedItems(matches); !reflect.DeepEqual(items, []string{"sxixtxe", "web/site"}) {
+		t.Errorf("Expected heavy usage to outrank a better match, got %v", items)
+	}
+}
@@ -0,0 +1,222 @@
+package history
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultRanking = "frecency,count,alpha"
+
+	rankerSeparator    = ","
+	rankerArgSeparator = ":"
+)
+
+type Candidate struct {
+	Item  string
+	Entry Entry
+}
+
+// Ranker orders history items. Compare returns a negative number when left ranks before right, a
+// positive number when right ranks before left and zero when the ranker cannot tell them apart.
+type Ranker interface {
+	Compare(left, right Candidate) int
+}
+
+type RankerFunc func(left, right Candidate) int
+
+func (f RankerFunc) Compare(left, right Candidate) int {
+	return f(left, right)
+}
+
+func compareDescending(left, right float64) int {
+	switch {
+	case left > right:
+		return -1
+	case left < right:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// scoreRanker ranks candidates with higher scores first. Its score only depends on the candidate,
+// so it is computed once per candidate when ranking instead of once per comparison.
+type scoreRanker struct {
+	score func(Candidate) float64
+}
+
+func (r scoreRanker) Compare(left, right Candidate) int {
+	return compareDescending(r.score(left), r.score(right))
+}
+
+// chain ranks by its first ranker and falls back to the following ones for ties.
+type chain []Ranker
+
+func (c chain) Compare(left, right Candidate) int {
+	for _, ranker := range c {
+		result := ranker.Compare(left, right)
+		if result != 0 {
+			return result
+		}
+	}
+	return 0
+}
+
+var ByCount Ranker = ByScore(CountScorer)
+
+var ByRecency Ranker = scoreRanker{score: func(candidate Candidate) float64 {
+	return float64(toUnix(candidate.Entry.LastUsed))
+}}
+
+var Alphabetical Ranker = RankerFunc(func(left, right Candidate) int {
+	return strings.Compare(left.Item, right.Item)
+})
+
+// ByScore ranks items with higher scores first.
+func ByScore(score Scorer) Ranker {
+	return scoreRanker{score: func(candidate Candidate) float64 {
+		return score(candidate.Entry)
+	}}
+}
+
+func ByFrecency(now time.Time, halfLife time.Duration) Ranker {
+	return ByScore(FrecencyScorer(now, halfLife))
+}
+
+func Then(rankers ...Ranker) Ranker {
+	flattened := make(chain, 0, len(rankers))
+	for _, ranker := range rankers {
+		nested, ok := ranker.(chain)
+		if ok {
+			flattened = append(flattened, nested...)
+		} else {
+			flattened = append(flattened, ranker)
+		}
+	}
+	return flattened
+}
+
+// rankedCandidate carries the scores of all score rankers of a compiled ranker.
+type rankedCandidate struct {
+	Candidate
+	scores []float64
+}
+
+// compiledRanker compares candidates using scores computed up front where it can.
+type compiledRanker struct {
+	rankers []Ranker
+	scorers []func(Candidate) float64
+}
+
+func compile(ranker Ranker) compiledRanker {
+	rankers, ok := ranker.(chain)
+	if !ok {
+		rankers = chain{ranker}
+	}
+	compiled := compiledRanker{rankers: rankers, scorers: make([]func(Candidate) float64, len(rankers))}
+	for index, r := range rankers {
+		scored, ok := r.(scoreRanker)
+		if ok {
+			compiled.scorers[index] = scored.score
+		}
+	}
+	return compiled
+}
+
+func (c compiledRanker) prepare(candidate Candidate) rankedCandidate {
+	ranked := rankedCandidate{Candidate: candidate, scores: make([]float64, len(c.scorers))}
+	for index, score := range c.scorers {
+		if score != nil {
+			ranked.scores[index] = score(candidate)
+		}
+	}
+	return ranked
+}
+
+func (c compiledRanker) compare(left, right *rankedCandidate) int {
+	for index, ranker := range c.rankers {
+		var result int
+		if c.scorers[index] != nil {
+			result = compareDescending(left.scores[index], right.scores[index])
+		} else {
+			result = ranker.Compare(left.Candidate, right.Candidate)
+		}
+		if result != 0 {
+			return result
+		}
+	}
+	return 0
+}
+
+func Rank(history History, ranker Ranker) []string {
+	compiled := compile(ranker)
+	candidates := make([]rankedCandidate, 0, len(history))
+	for item, entry := range history {
+		candidates = append(candidates, compiled.prepare(Candidate{Item: item, Entry: entry}))
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return compiled.compare(&candidates[i], &candidates[j]) < 0
+	})
+	items := make([]string, 0, len(candidates))
+	for _, candidate := range candidates {
+		items = append(items, candidate.Item)
+	}
+	return items
+}
+
+func parseRanker(spec string, now time.Time) (Ranker, error) {
+	name, argument := spec, ""
+	separatorIndex := strings.Index(spec, rankerArgSeparator)
+	if separatorIndex >= 0 {
+		name, argument = spec[:separatorIndex], spec[separatorIndex+1:]
+	}
+	if argument != "" && name != "frecency" {
+		return nil, fmt.Errorf("Ranker %s takes no arguments", name)
+	}
+
+	switch name {
+	case "count":
+		return ByCount, nil
+	case "recency":
+		return ByRecency, nil
+	case "alpha":
+		return Alphabetical, nil
+	case "frecency":
+		halfLife := DefaultHalfLife
+		if argument != "" {
+			var err error
+			halfLife, err = time.ParseDuration(argument)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid frecency half life %s: %w", argument, err)
+			}
+		}
+		return ByFrecency(now, halfLife), nil
+	default:
+		return nil, fmt.Errorf("Unknown ranker %s", name)
+	}
+}
+
+// ParseRanking builds a ranker from a comma separated list of ranker names, each one breaking the
+// ties of the previous ones, such as `frecency:72h,count,alpha`. Known rankers are count, recency,
+// frecency with an optional half life, and alpha.
+func ParseRanking(spec string, now time.Time) (Ranker, error) {
+	rankers := make([]Ranker, 0)
+	for _, rankerSpec := range strings.Split(spec, rankerSeparator) {
+		rankerSpec = strings.TrimSpace(rankerSpec)
+		if rankerSpec == "" {
+			continue
+		}
+		ranker, err := parseRanker(rankerSpec, now)
+		if err != nil {
+			return nil, err
+		}
+		rankers = append(rankers, ranker)
+	}
+	if len(rankers) == 0 {
+		return nil, fmt.Errorf("Empty ranking")
+	}
+	return Then(rankers...), nil
+}
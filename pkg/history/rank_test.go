@@ -0,0 +1,72 @@
+package history
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var rankNow = time.Unix(1600000000, 0)
+
+// randomHistory has items with few distinct counts and use times, so ties have to be broken.
+func randomHistory(size int) History {
+	random := rand.New(rand.NewSource(int64(size)))
+	history := make(History, size)
+	for i := 0; i < size; i++ {
+		lastUsed := rankNow.Add(-time.Duration(random.Intn(1000)) * time.Hour)
+		history[fmt.Sprintf("item-%d", i)] = Entry{Count: random.Intn(20) + 1, LastUsed: lastUsed,
+			Recent: []time.Time{lastUsed}}
+	}
+	return history
+}
+
+func testRanker(t testing.TB) Ranker {
+	ranker, err := ParseRanking(DefaultRanking, rankNow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ranker
+}
+
+func TestRankTopMatchesRank(t *testing.T) {
+	history := randomHistory(5000)
+	ranker := testRanker(t)
+	ranked := Rank(history, ranker)
+	for _, k := range []int{1, 10, 100, 4999, 5000} {
+		top := RankTop(history, ranker, k)
+		if !reflect.DeepEqual(top, ranked[:k]) {
+			t.Errorf("Expected the top %d items to be %v, got %v", k, ranked[:k], top)
+		}
+	}
+	if len(RankTop(history, ranker, 6000)) != len(history) {
+		t.Error("Expected all items when asking for more than there are")
+	}
+	if len(RankTop(history, ranker, 0)) != 0 {
+		t.Error("Expected no items when asking for none")
+	}
+}
+
+func benchmarkRank(b *testing.B, rank func(History, Ranker) []string) {
+	for _, size := range []int{100000, 1000000} {
+		history := randomHistory(size)
+		ranker := testRanker(b)
+		b.Run(fmt.Sprintf("%d", size), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				rank(history, ranker)
+			}
+		})
+	}
+}
+
+func BenchmarkRank(b *testing.B) {
+	benchmarkRank(b, Rank)
+}
+
+func BenchmarkRankTop(b *testing.B) {
+	benchmarkRank(b, func(history History, ranker Ranker) []string {
+		return RankTop(history, ranker, 20)
+	})
+}
@@ -0,0 +1,100 @@
+package history
+
+import "time"
+
+// RetentionPolicy describes which entries a history keeps. Zero values disable the corresponding
+// rule.
+type RetentionPolicy struct {
+	// MaxEntries keeps only this many entries, ranked by frecency.
+	MaxEntries int
+	// MaxAge drops entries that have not been used for longer than this. Entries without a known
+	// last use time are kept.
+	MaxAge time.Duration
+	// MinCount drops entries used fewer times than this, after halving.
+	MinCount int
+	// HalveEvery halves the count of every entry once per elapsed period, so that counts from long
+	// ago age out. Entries that reach a count of zero are dropped. Merging with a copy of the
+	// history that has not been halved yet restores the larger counts unless the copies are
+	// merged with MergeHalving and the same period.
+	HalveEvery time.Duration
+}
+
+const maxHalvings = 62
+
+func halveEntry(entry Entry, halveEvery time.Duration, now time.Time) Entry {
+	if entry.DecayedAt.IsZero() {
+		entry.DecayedAt = now
+		return entry
+	}
+	periods := int(now.Sub(entry.DecayedAt) / halveEvery)
+	if periods <= 0 {
+		return entry
+	}
+	entry.DecayedAt = entry.DecayedAt.Add(time.Duration(periods) * halveEvery)
+	if periods > maxHalvings {
+		periods = maxHalvings
+	}
+	unattributed := unattributedCount(entry) >> uint(periods)
+	entry = copyEntry(entry)
+	for device := range entry.Devices {
+		entry.Devices[device] >>= uint(periods)
+	}
+	entry.Count = unattributed + attributedCount(entry)
+	if len(entry.Recent) > entry.Count {
+		entry.Recent = entry.Recent[len(entry.Recent)-entry.Count:]
+	}
+	return entry
+}
+
+func keepEntry(entry Entry, policy RetentionPolicy, now time.Time) bool {
+	if entry.Count <= 0 || entry.Count < policy.MinCount {
+		return false
+	}
+	if policy.MaxAge > 0 && !entry.LastUsed.IsZero() && now.Sub(entry.LastUsed) > policy.MaxAge {
+		return false
+	}
+	return true
+}
+
+// ApplyRetention returns the entries of history that policy keeps, with their counts halved when
+// the policy asks for it.
+func ApplyRetention(history History, policy RetentionPolicy, now time.Time) History {
+	retained := make(History)
+	for item, entry := range history {
+		if policy.HalveEvery > 0 {
+			entry = halveEntry(entry, policy.HalveEvery, now)
+		}
+		if keepEntry(entry, policy, now) {
+			retained[item] = entry
+		}
+	}
+	if policy.MaxEntries <= 0 || len(retained) <= policy.MaxEntries {
+		return retained
+	}
+	ranked := GetOrderedHistoryByFrecency(retained, now, DefaultHalfLife)
+	for _, item := range ranked[policy.MaxEntries:] {
+		delete(retained, item)
+	}
+	return retained
+}
+
+// Compact applies policy to the history in backend and rewrites it, returning the number of
+// entries that were dropped.
+func Compact(backend Backend, policy RetentionPolicy, now time.Time) (int, error) {
+	dropped := 0
+	err := update(backend, func(history History) error {
+		retained := ApplyRetention(history, policy, now)
+		dropped = len(history) - len(retained)
+		for item := range history {
+			_, kept := retained[item]
+			if !kept {
+				delete(history, item)
+			}
+		}
+		for item, entry := range retained {
+			history[item] = entry
+		}
+		return nil
+	})
+	return dropped, err
+}
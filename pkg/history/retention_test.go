@@ -0,0 +1,110 @@
+package history
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var retentionNow = time.Unix(1700000000, 0)
+
+func TestRetentionMaxEntries(t *testing.T) {
+	history := History{
+		"old":    {Count: 20, LastUsed: retentionNow.Add(-60 * 24 * time.Hour)},
+		"recent": {Count: 1, LastUsed: retentionNow.Add(-time.Hour)},
+		"often":  {Count: 5, LastUsed: retentionNow.Add(-24 * time.Hour)},
+	}
+	retained := ApplyRetention(history, RetentionPolicy{MaxEntries: 2}, retentionNow)
+	if items := sortedItems(retained); !reflect.DeepEqual(items, []string{"often", "recent"}) {
+		t.Errorf("Expected the two entries with the highest frecency, got %v", items)
+	}
+}
+
+func TestRetentionMaxAge(t *testing.T) {
+	history := History{
+		"stale":   {Count: 10, LastUsed: retentionNow.Add(-31 * 24 * time.Hour)},
+		"fresh":   {Count: 1, LastUsed: retentionNow.Add(-29 * 24 * time.Hour)},
+		"unknown": {Count: 1},
+	}
+	retained := ApplyRetention(history, RetentionPolicy{MaxAge: 30 * 24 * time.Hour}, retentionNow)
+	if items := sortedItems(retained); !reflect.DeepEqual(items, []string{"fresh", "unknown"}) {
+		t.Errorf("Expected entries without a last use time to be kept, got %v", items)
+	}
+}
+
+func TestRetentionMinCountAfterHalving(t *testing.T) {
+	decayedAt := retentionNow.Add(-testHalveEvery)
+	history := History{
+		"a": {Count: 7, DecayedAt: decayedAt},
+		"b": {Count: 5, DecayedAt: decayedAt},
+		"c": {Count: 5},
+	}
+	retained := ApplyRetention(history, RetentionPolicy{MinCount: 3, HalveEvery: testHalveEvery}, retentionNow)
+	// a is halved to 3 and b to 2, c has never been halved and starts its first period now.
+	if items := sortedItems(retained); !reflect.DeepEqual(items, []string{"a", "c"}) {
+		t.Errorf("Expected the minimum count to apply to halved counts, got %v", retained)
+	}
+	if retained["a"].Count != 3 || retained["c"].Count != 5 || !retained["c"].DecayedAt.Equal(retentionNow) {
+		t.Errorf("Unexpected retained entries %v", retained)
+	}
+}
+
+func TestRetentionHalvesEveryPeriod(t *testing.T) {
+	decayedAt := retentionNow.Add(-3*testHalveEvery - time.Hour)
+	history := History{
+		"a": {Count: 40, DecayedAt: decayedAt, Devices: map[string]int{"laptop": 24, "phone": 8}},
+		"b": {Count: 4, DecayedAt: decayedAt},
+	}
+	retained := ApplyRetention(history, RetentionPolicy{HalveEvery: testHalveEvery}, retentionNow)
+	a := retained["a"]
+	// 8 unattributed uses, 24 and 8 on devices, each halved three times.
+	if a.Count != 5 || a.Devices["laptop"] != 3 || a.Devices["phone"] != 1 {
+		t.Errorf("Expected three halvings, got %v", a)
+	}
+	if expected := decayedAt.Add(3 * testHalveEvery); !a.DecayedAt.Equal(expected) {
+		t.Errorf("Expected the halving time to advance by whole periods to %v, got %v", expected, a.DecayedAt)
+	}
+	if _, kept := retained["b"]; kept {
+		t.Errorf("Expected entries halved to zero to be dropped, got %v", retained)
+	}
+	if history["a"].Devices["laptop"] != 24 {
+		t.Error("Expected the original history to be left alone")
+	}
+
+	again := ApplyRetention(retained, RetentionPolicy{HalveEvery: testHalveEvery}, retentionNow)
+	if !reflect.DeepEqual(again, retained) {
+		t.Errorf("Expected halving again within the period to change nothing, got %v", again)
+	}
+}
+
+func TestCompact(t *testing.T) {
+	store := NewStore(filepath.Join(t.TempDir(), "history"))
+	err := store.Replace(History{
+		"a": {Count: 4, LastUsed: retentionNow},
+		"b": {Count: 1, LastUsed: retentionNow},
+		"c": {Count: 2, LastUsed: retentionNow.Add(-48 * time.Hour)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dropped, err := Compact(store, RetentionPolicy{MinCount: 2, MaxAge: 24 * time.Hour}, retentionNow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dropped != 2 {
+		t.Errorf("Expected 2 dropped entries, got %d", dropped)
+	}
+	history, err := store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if items := sortedItems(history); !reflect.DeepEqual(items, []string{"a"}) {
+		t.Errorf("Expected only a to be kept, got %v", history)
+	}
+
+	dropped, err = Compact(store, RetentionPolicy{MinCount: 2, MaxAge: 24 * time.Hour}, retentionNow)
+	if err != nil || dropped != 0 {
+		t.Errorf("Expected compacting again to drop nothing, got %d, %v", dropped, err)
+	}
+}
@@ -0,0 +1,287 @@
+package history
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	lockSuffix    = ".lock"
+	storeDirMode  = 0700 | os.ModeDir
+	storeFileMode = 0600
+)
+
+// Store keeps a History in a file. Every update happens under an exclusive advisory lock on a
+// sibling lock file and replaces the history file atomically, so concurrent writers never lose or
+// interleave updates and a crash leaves either the old or the new file behind.
+type Store struct {
+	path   string
+	cipher *Cipher
+	// OnParseError makes the store lenient when set: lines that cannot be decoded are passed to it
+	// and skipped instead of failing the load. Skipped lines are dropped on the next update.
+	OnParseError func(*ParseError)
+}
+
+func NewStore(path string) *Store {
+	return &Store{path: path}
+}
+
+// NewEncryptedStore returns a store that encrypts the history with c. A plaintext history is still
+// read, and is encrypted the next time the store is written.
+func NewEncryptedStore(path string, c *Cipher) *Store {
+	return &Store{path: path, cipher: c}
+}
+
+func (s *Store) Path() string {
+	return s.path
+}
+
+func (s *Store) lock(how int) (*os.File, error) {
+	err := os.MkdirAll(filepath.Dir(s.path), storeDirMode)
+	if err != nil {
+		return nil, err
+	}
+	lockFile, err := os.OpenFile(s.path+lockSuffix, os.O_RDWR|os.O_CREATE, storeFileMode)
+	if err != nil {
+		return nil, err
+	}
+	err = syscall.Flock(int(lockFile.Fd()), how)
+	if err != nil {
+		lockFile.Close()
+		return nil, err
+	}
+	return lockFile, nil
+}
+
+func unlock(lockFile *os.File) {
+	syscall.Flock(int(lockFile.Fd()), syscall.LOCK_UN)
+	lockFile.Close()
+}
+
+func (s *Store) readContent() ([]byte, error) {
+	content, err := ioutil.ReadFile(s.path)
+	if err != nil || !IsEncrypted(content) {
+		return content, err
+	}
+	if s.cipher == nil {
+		return nil, ErrMissingKey
+	}
+	return s.cipher.Open(content)
+}
+
+func (s *Store) read() (History, error) {
+	history, _, err := s.readWithHeader()
+	return history, err
+}
+
+func (s *Store) readWithHeader() (History, header, error) {
+	content, err := s.readContent()
+	if os.IsNotExist(err) {
+		return make(History), newHeader(), nil
+	} else if err != nil {
+		return nil, header{}, err
+	}
+
+	history, fileHeader, parseErrors, err := decode(bytes.NewReader(content), s.OnParseError != nil)
+	if err != nil {
+		return nil, header{}, err
+	}
+	for _, parseError := range parseErrors {
+		s.OnParseError(parseError)
+	}
+	return history, fileHeader, nil
+}
+
+// readHeader only reads as much of the history as needed to get at its header.
+func (s *Store) readHeader() (header, error) {
+	file, err := os.Open(s.path)
+	if os.IsNotExist(err) {
+		return newHeader(), nil
+	} else if err != nil {
+		return header{}, err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	firstLine, err := reader.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return header{}, err
+	}
+	if IsEncrypted([]byte(firstLine)) {
+		// Encrypted histories carry their header as label, histories sealed before there were
+		// labels have to be decrypted.
+		label, err := reader.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return header{}, err
+		}
+		h, ok := parseHeader(strings.TrimSpace(label))
+		if ok {
+			return h, nil
+		}
+		_, h, err = s.readWithHeader()
+		return h, err
+	}
+	h, _ := parseHeader(strings.TrimSpace(firstLine))
+	return h, nil
+}
+
+func (s *Store) seal(content []byte, h header) ([]byte, error) {
+	if s.cipher == nil {
+		return content, nil
+	}
+	label, err := json.Marshal(h)
+	if err != nil {
+		return nil, err
+	}
+	return s.cipher.SealWithLabel(content, label)
+}
+
+func (s *Store) encode(history History, h header) ([]byte, error) {
+	var buffer bytes.Buffer
+	err := encode(&buffer, history, h)
+	if err != nil {
+		return nil, err
+	}
+	return s.seal(buffer.Bytes(), h)
+}
+
+func syncDir(dir string) error {
+	dirFile, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer dirFile.Close()
+	return dirFile.Sync()
+}
+
+func (s *Store) write(history History) error {
+	return s.writeWithHeader(history, newHeader())
+}
+
+func (s *Store) writeWithHeader(history History, h header) error {
+	content, err := s.encode(history, h)
+	if err != nil {
+		return err
+	}
+	return replaceFile(s.path, content)
+}
+
+// replaceFile atomically replaces the file at path with content.
+func replaceFile(path string, content []byte) error {
+	dir := filepath.Dir(path)
+	tempFile, err := ioutil.TempFile(dir, filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	tempPath := tempFile.Name()
+	defer os.Remove(tempPath)
+
+	_, err = tempFile.Write(content)
+	if err == nil {
+		err = tempFile.Chmod(storeFileMode)
+	}
+	if err == nil {
+		err = tempFile.Sync()
+	}
+	closeErr := tempFile.Close()
+	if err != nil {
+		return err
+	}
+	if closeErr != nil {
+		return closeErr
+	}
+
+	err = os.Rename(tempPath, path)
+	if err != nil {
+		return err
+	}
+	return syncDir(dir)
+}
+
+func (s *Store) Load() (History, error) {
+	lockFile, err := s.lock(syscall.LOCK_SH)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock(lockFile)
+	return s.read()
+}
+
+// Update reads the stored history, lets fn modify it and writes the result back, all while holding
+// the store lock. Nothing is written if fn returns an error.
+func (s *Store) Update(fn func(History) error) error {
+	lockFile, err := s.lock(syscall.LOCK_EX)
+	if err != nil {
+		return err
+	}
+	defer unlock(lockFile)
+
+	history, err := s.read()
+	if err != nil {
+		return err
+	}
+	err = fn(history)
+	if err != nil {
+		return err
+	}
+	return s.write(history)
+}
+
+func (s *Store) Record(item string, when time.Time) error {
+	return s.Update(func(history History) error {
+		AddToHistoryAt(history, item, when)
+		return nil
+	})
+}
+
+func (s *Store) Put(item string, entry Entry) error {
+	return s.Update(func(history History) error {
+		history[item] = entry
+		return nil
+	})
+}
+
+func (s *Store) Forget(item string) error {
+	return s.Update(func(history History) error {
+		delete(history, item)
+		return nil
+	})
+}
+
+func (s *Store) Replace(history History) error {
+	lockFile, err := s.lock(syscall.LOCK_EX)
+	if err != nil {
+		return err
+	}
+	defer unlock(lockFile)
+	return s.write(history)
+}
+
+// Rekey reads the history with the cipher of the store and writes it back encrypted with c, which
+// the store uses from then on.
+func (s *Store) Rekey(c *Cipher) error {
+	lockFile, err := s.lock(syscall.LOCK_EX)
+	if err != nil {
+		return err
+	}
+	defer unlock(lockFile)
+
+	history, err := s.read()
+	if err != nil {
+		return err
+	}
+	s.cipher = c
+	return s.write(history)
+}
+
+func (s *Store) Close() error {
+	return nil
+}
@@ -0,0 +1,188 @@
+package history
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	helperStoreEnvVar   = "STUFF_HISTORY_TEST_STORE"
+	helperRecordsEnvVar = "STUFF_HISTORY_TEST_RECORDS"
+
+	concurrentWriters = 8
+	recordsPerWriter  = 25
+)
+
+// TestHelperRecord is not a test of its own, but records uses in the store given by the
+// environment when run as a separate process by the tests below.
+func TestHelperRecord(t *testing.T) {
+	path := os.Getenv(helperStoreEnvVar)
+	if path == "" {
+		t.Skip("Only run as a helper process")
+	}
+	records, err := strconv.Atoi(os.Getenv(helperRecordsEnvVar))
+	if err != nil {
+		t.Fatal(err)
+	}
+	recordUses(t, NewStore(path), records)
+}
+
+func recordUses(t *testing.T, store *Store, records int) {
+	for i := 0; i < records; i++ {
+		err := store.Record("item", time.Now())
+		if err != nil {
+			t.Error(err)
+			return
+		}
+	}
+}
+
+func expectCount(t *testing.T, path string, count int) {
+	t.Helper()
+	history, err := NewStore(path).Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if history["item"].Count != count {
+		t.Errorf("Expected %d recorded uses, got %d", count, history["item"].Count)
+	}
+}
+
+func TestConcurrentWriters(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history")
+	var wait sync.WaitGroup
+	for i := 0; i < concurrentWriters; i++ {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			recordUses(t, NewStore(path), recordsPerWriter)
+		}()
+	}
+	wait.Wait()
+	expectCount(t, path, concurrentWriters*recordsPerWriter)
+}
+
+func TestConcurrentWriterProcesses(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history")
+	var commands []*exec.Cmd
+	for i := 0; i < concurrentWriters; i++ {
+		cmd := exec.Command(os.Args[0], "-test.run=^TestHelperRecord$")
+		cmd.Env = append(os.Environ(), helperStoreEnvVar+"="+path,
+			fmt.Sprintf("%s=%d", helperRecordsEnvVar, recordsPerWriter))
+		cmd.Stderr = os.Stderr
+		err := cmd.Start()
+		if err != nil {
+			t.Fatal(err)
+		}
+		commands = append(commands, cmd)
+	}
+	// The test process writes along with the helpers.
+	recordUses(t, NewStore(path), recordsPerWriter)
+	for _, cmd := range commands {
+		err := cmd.Wait()
+		if err != nil {
+			t.Error(err)
+		}
+	}
+	expectCount(t, path, (concurrentWriters+1)*recordsPerWriter)
+}
+
+func historyOfSize(size int) History {
+	history := make(History, size)
+	for i := 0; i < size; i++ {
+		history[fmt.Sprintf("item-%d", i)] = Entry{Count: 1, LastUsed: time.Unix(1600000000, 0)}
+	}
+	return history
+}
+
+func TestReplaceIsAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "history")
+	store := NewStore(path)
+	small, large := historyOfSize(1), historyOfSize(1000)
+	err := store.Replace(small)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan struct{})
+	var wait sync.WaitGroup
+	wait.Add(1)
+	go func() {
+		defer wait.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			// Reading without the lock sees whatever file is in place.
+			history, err := NewStore(path).read()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if len(history) != len(small) && len(history) != len(large) {
+				t.Errorf("Read a partially written history of %d items", len(history))
+				return
+			}
+		}
+	}()
+	for i := 0; i < 50; i++ {
+		replacement := large
+		if i%2 == 1 {
+			replacement = small
+		}
+		err = store.Replace(replacement)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	close(done)
+	wait.Wait()
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		if file.Name() != "history" && file.Name() != "history"+lockSuffix {
+			t.Errorf("Expected no temporary files to be left behind, found %s", file.Name())
+		}
+	}
+}
+
+func TestShrinkingHistoryIsTruncated(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history")
+	store := NewStore(path)
+	err := store.Replace(historyOfSize(100))
+	if err != nil {
+		t.Fatal(err)
+	}
+	small := historyOfSize(2)
+	err = store.Replace(small)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var expected bytes.Buffer
+	err = encode(&expected, small, newHeader())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(content, expected.Bytes()) {
+		t.Errorf("Expected only the smaller history in the file, got\n%s", content)
+	}
+}
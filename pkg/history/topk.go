@@ -0,0 +1,82 @@
+package history
+
+import (
+	"container/heap"
+	"sort"
+)
+
+// candidateHeap keeps the worst ranked candidate on top so it can be evicted by a better one.
+type candidateHeap struct {
+	ranker     compiledRanker
+	candidates []rankedCandidate
+}
+
+func (h *candidateHeap) Len() int {
+	return len(h.candidates)
+}
+
+func (h *candidateHeap) Less(i, j int) bool {
+	return h.ranker.compare(&h.candidates[i], &h.candidates[j]) > 0
+}
+
+func (h *candidateHeap) Swap(i, j int) {
+	h.candidates[i], h.candidates[j] = h.candidates[j], h.candidates[i]
+}
+
+func (h *candidateHeap) Push(x interface{}) {
+	h.candidates = append(h.candidates, x.(rankedCandidate))
+}
+
+func (h *candidateHeap) Pop() interface{} {
+	last := h.candidates[len(h.candidates)-1]
+	h.candidates = h.candidates[:len(h.candidates)-1]
+	return last
+}
+
+// TopK collects the k best ranked candidates from a stream of candidates in O(n log k) time and
+// O(k) memory.
+type TopK struct {
+	k    int
+	heap *candidateHeap
+}
+
+func NewTopK(k int, ranker Ranker) *TopK {
+	return &TopK{k: k, heap: &candidateHeap{ranker: compile(ranker)}}
+}
+
+func (t *TopK) Push(candidate Candidate) {
+	if t.k <= 0 {
+		return
+	}
+	ranked := t.heap.ranker.prepare(candidate)
+	if t.heap.Len() < t.k {
+		heap.Push(t.heap, ranked)
+		return
+	}
+	if t.heap.ranker.compare(&ranked, &t.heap.candidates[0]) < 0 {
+		t.heap.candidates[0] = ranked
+		heap.Fix(t.heap, 0)
+	}
+}
+
+// Items returns the collected items, best ranked first.
+func (t *TopK) Items() []string {
+	candidates := append([]rankedCandidate(nil), t.heap.candidates...)
+	sort.Slice(candidates, func(i, j int) bool {
+		return t.heap.ranker.compare(&candidates[i], &candidates[j]) < 0
+	})
+	items := make([]string, 0, len(candidates))
+	for _, candidate := range candidates {
+		items = append(items, candidate.Item)
+	}
+	return items
+}
+
+// RankTop returns the k best ranked items of history.
+func RankTop(history History, ranker Ranker, k int) []string {
+	top := NewTopK(k, ranker)
+	for item, entry := range history {
+		top.Push(Candidate{Item: item, Entry: entry})
+	}
+	return top.Items()
+}
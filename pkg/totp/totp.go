@@ -0,0 +1,175 @@
+// Package totp generates time based one-time passwords as described in RFC 6238 from keys given
+// as otpauth URIs.
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultDigits = 6
+	DefaultPeriod = 30 * time.Second
+
+	scheme    = "otpauth"
+	totpType  = "totp"
+	minDigits = 1
+	maxDigits = 10
+)
+
+var (
+	ErrNotOtpauth  = errors.New("Not an otpauth URI")
+	ErrNotTOTP     = errors.New("Not a TOTP key")
+	ErrEmptySecret = errors.New("Empty secret")
+)
+
+type Algorithm string
+
+const (
+	SHA1   Algorithm = "SHA1"
+	SHA256 Algorithm = "SHA256"
+	SHA512 Algorithm = "SHA512"
+)
+
+func (a Algorithm) hash() (func() hash.Hash, error) {
+	switch a {
+	case SHA1:
+		return sha1.New, nil
+	case SHA256:
+		return sha256.New, nil
+	case SHA512:
+		return sha512.New, nil
+	default:
+		return nil, fmt.Errorf("Unsupported algorithm %s", a)
+	}
+}
+
+type Key struct {
+	Issuer    string
+	Account   string
+	Secret    []byte
+	Digits    int
+	Period    time.Duration
+	Algorithm Algorithm
+}
+
+// DecodeSecret decodes a base32 secret the way authenticator apps accept it: in any case, with or
+// without padding and with spaces in between.
+func DecodeSecret(secret string) ([]byte, error) {
+	secret = strings.ToUpper(strings.ReplaceAll(secret, " ", ""))
+	secret = strings.TrimRight(secret, "=")
+	if secret == "" {
+		return nil, ErrEmptySecret
+	}
+	decoded, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid secret: %w", err)
+	}
+	return decoded, nil
+}
+
+func parseLabel(key *Key, label string) {
+	label = strings.TrimPrefix(label, "/")
+	separatorIndex := strings.Index(label, ":")
+	if separatorIndex < 0 {
+		key.Account = label
+		return
+	}
+	key.Issuer = label[:separatorIndex]
+	key.Account = strings.TrimSpace(label[separatorIndex+1:])
+}
+
+// ParseURI parses a key in the otpauth URI format, such as
+// `otpauth://totp/Example:alice@example.com?secret=JBSWY3DPEHPK3PXP&issuer=Example`. Digits, period
+// and algorithm default to 6, 30 seconds and SHA1.
+func ParseURI(uri string) (Key, error) {
+	parsed, err := url.Parse(strings.TrimSpace(uri))
+	if err != nil {
+		return Key{}, err
+	}
+	if parsed.Scheme != scheme {
+		return Key{}, ErrNotOtpauth
+	}
+	if !strings.EqualFold(parsed.Host, totpType) {
+		return Key{}, ErrNotTOTP
+	}
+
+	key := Key{Digits: DefaultDigits, Period: DefaultPeriod, Algorithm: SHA1}
+	parseLabel(&key, parsed.Path)
+	query := parsed.Query()
+	if query.Get("issuer") != "" {
+		key.Issuer = query.Get("issuer")
+	}
+	key.Secret, err = DecodeSecret(query.Get("secret"))
+	if err != nil {
+		return Key{}, err
+	}
+	if query.Get("digits") != "" {
+		key.Digits, err = strconv.Atoi(query.Get("digits"))
+		if err != nil || key.Digits < minDigits || key.Digits > maxDigits {
+			return Key{}, fmt.Errorf("Invalid digits %s", query.Get("digits"))
+		}
+	}
+	if query.Get("period") != "" {
+		seconds, err := strconv.Atoi(query.Get("period"))
+		if err != nil || seconds <= 0 {
+			return Key{}, fmt.Errorf("Invalid period %s", query.Get("period"))
+		}
+		key.Period = time.Duration(seconds) * time.Second
+	}
+	if query.Get("algorithm") != "" {
+		key.Algorithm = Algorithm(strings.ToUpper(query.Get("algorithm")))
+		_, err = key.Algorithm.hash()
+		if err != nil {
+			return Key{}, err
+		}
+	}
+	return key, nil
+}
+
+// HOTP computes the RFC 4226 one-time password of secret for counter.
+func HOTP(secret []byte, counter uint64, digits int, algorithm Algorithm) (string, error) {
+	newHash, err := algorithm.hash()
+	if err != nil {
+		return "", err
+	}
+	var message [8]byte
+	binary.BigEndian.PutUint64(message[:], counter)
+	mac := hmac.New(newHash, secret)
+	mac.Write(message[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	truncated := uint64(binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff)
+	modulus := uint64(1)
+	for i := 0; i < digits; i++ {
+		modulus *= 10
+	}
+	return fmt.Sprintf("%0*d", digits, truncated%modulus), nil
+}
+
+func (k Key) counter(t time.Time) uint64 {
+	return uint64(t.Unix() / int64(k.Period/time.Second))
+}
+
+// Code returns the one-time password valid at t.
+func (k Key) Code(t time.Time) (string, error) {
+	return HOTP(k.Secret, k.counter(t), k.Digits, k.Algorithm)
+}
+
+// Remaining returns how much longer the code valid at t stays valid.
+func (k Key) Remaining(t time.Time) time.Duration {
+	periodStart := time.Unix(int64(k.counter(t))*int64(k.Period/time.Second), 0)
+	return k.Period - t.Sub(periodStart)
+}
@@ -0,0 +1,103 @@
+package totp
+
+import (
+	"testing"
+	"time"
+)
+
+var rfcSecrets = map[Algorithm][]byte{
+	SHA1:   []byte("12345678901234567890"),
+	SHA256: []byte("12345678901234567890123456789012"),
+	SHA512: []byte("1234567890123456789012345678901234567890123456789012345678901234"),
+}
+
+// The test vectors of RFC 6238, appendix B.
+var rfc6238Vectors = []struct {
+	unix  int64
+	codes map[Algorithm]string
+}{
+	{59, map[Algorithm]string{SHA1: "94287082", SHA256: "46119246", SHA512: "90693936"}},
+	{1111111109, map[Algorithm]string{SHA1: "07081804", SHA256: "68084774", SHA512: "25091201"}},
+	{1111111111, map[Algorithm]string{SHA1: "14050471", SHA256: "67062674", SHA512: "99943326"}},
+	{1234567890, map[Algorithm]string{SHA1: "89005924", SHA256: "91819424", SHA512: "93441116"}},
+	{2000000000, map[Algorithm]string{SHA1: "69279037", SHA256: "90698825", SHA512: "38618901"}},
+	{20000000000, map[Algorithm]string{SHA1: "65353130", SHA256: "77737706", SHA512: "47863826"}},
+}
+
+func TestRFC6238Vectors(t *testing.T) {
+	for _, vector := range rfc6238Vectors {
+		for algorithm, expected := range vector.codes {
+			key := Key{Secret: rfcSecrets[algorithm], Digits: 8, Period: DefaultPeriod, Algorithm: algorithm}
+			code, err := key.Code(time.Unix(vector.unix, 0))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if code != expected {
+				t.Errorf("Expected %s for %s at %d, got %s", expected, algorithm, vector.unix, code)
+			}
+		}
+	}
+}
+
+// The test vectors of RFC 4226, appendix D.
+func TestRFC4226Vectors(t *testing.T) {
+	expected := []string{"755224", "287082", "359152", "969429", "338314", "254676", "287922", "162583",
+		"399871", "520489"}
+	for counter, code := range expected {
+		actual, err := HOTP(rfcSecrets[SHA1], uint64(counter), 6, SHA1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if actual != code {
+			t.Errorf("Expected %s for counter %d, got %s", code, counter, actual)
+		}
+	}
+}
+
+func TestParseURI(t *testing.T) {
+	key, err := ParseURI("otpauth://totp/Ex:alice?secret=jbsw%20y3dpehpk3pxp&period=60&digits=8&algorithm=sha256")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key.Issuer != "Ex" || key.Account != "alice" {
+		t.Errorf("Unexpected label %s:%s", key.Issuer, key.Account)
+	}
+	if string(key.Secret) != "Hello!\xde\xad\xbe\xef" {
+		t.Errorf("Unexpected secret %x", key.Secret)
+	}
+	if key.Digits != 8 || key.Period != time.Minute || key.Algorithm != SHA256 {
+		t.Errorf("Unexpected parameters %+v", key)
+	}
+	if remaining := key.Remaining(time.Unix(130, 0)); remaining != 50*time.Second {
+		t.Errorf("Expected 50s remaining, got %s", remaining)
+	}
+}
+
+func TestParseURIDefaults(t *testing.T) {
+	key, err := ParseURI("otpauth://totp/alice?secret=JBSWY3DPEHPK3PXP&issuer=Example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key.Issuer != "Example" || key.Account != "alice" {
+		t.Errorf("Unexpected label %s:%s", key.Issuer, key.Account)
+	}
+	if key.Digits != DefaultDigits || key.Period != DefaultPeriod || key.Algorithm != SHA1 {
+		t.Errorf("Unexpected defaults %+v", key)
+	}
+}
+
+func TestParseInvalidURI(t *testing.T) {
+	for _, uri := range []string{
+		"https://example.com",
+		"otpauth://hotp/alice?secret=JBSWY3DPEHPK3PXP",
+		"otpauth://totp/alice",
+		"otpauth://totp/alice?secret=JBSWY3DPEHPK3PXP&digits=11",
+		"otpauth://totp/alice?secret=JBSWY3DPEHPK3PXP&period=0",
+		"otpauth://totp/alice?secret=JBSWY3DPEHPK3PXP&algorithm=md5",
+	} {
+		_, err := ParseURI(uri)
+		if err == nil {
+			t.Errorf("Expected an error parsing %s", uri)
+		}
+	}
+}